@@ -1,6 +1,11 @@
 package pwcache
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"math/bits"
+
 	"github.com/Sam-Yang6/pwcache/pwqueue"
 	"github.com/sarchlab/akita/v3/sim"
 )
@@ -14,9 +19,35 @@ type Builder struct {
 	numWays        int
 	pageSize       uint64
 	log2PageSize   uint64
+	pageSizeSet    bool
+	log2Set        bool
 	lowModule      sim.Port
 	numMSHREntry   int
 	lenpwqueue     int
+	numWalkers     int
+	lookupLatency  int
+	levelLatency   int
+	partitionMode  PartitionMode
+	reservedWays   [numLevels]int
+	costWeights    [numLevels]int
+	costWeightsSet bool
+	partitionEpoch uint64
+	insertion      InsertionPolicy
+	maxPinnedWays  int
+	arbitration    ArbitrationPolicy
+	deviceWeights  map[uint64]int
+	devQueueSize   int
+	sharing        SharingPolicy
+	deviceWayQuota int
+	topBufSizes    []int
+	onViolation    ViolationHandler
+	lookupMode     LookupMode
+	recorder       *Recorder
+	missClass      bool
+	reuseProfiling bool
+	replacement    ReplacementPolicy
+	oracle         *Oracle
+	shadows        []ShadowConfig
 }
 
 // MakeBuilder returns a Builder
@@ -30,6 +61,16 @@ func MakeBuilder() Builder {
 		log2PageSize:   12,
 		numMSHREntry:   4,
 		lenpwqueue:     64,
+		numWalkers:     8,
+		lookupLatency:  10,
+		levelLatency:   100,
+		partitionMode:  PartitionNone,
+		partitionEpoch: 1024,
+		insertion:      InsertAll,
+		maxPinnedWays:  8,
+		arbitration:    ArbitrationNone,
+		devQueueSize:   4,
+		sharing:        SharingNone,
 	}
 }
 
@@ -59,9 +100,11 @@ func (b Builder) WithNumWays(n int) Builder {
 	return b
 }
 
-// WithPageSize sets the page size that the TLB works with.
+// WithPageSize sets the page size that the TLB works with. Unless
+// WithLog2PageSize is also used, the log2 of the page size is derived from it.
 func (b Builder) WithPageSize(n uint64) Builder {
 	b.pageSize = n
+	b.pageSizeSet = true
 	return b
 }
 
@@ -91,14 +134,217 @@ func (b Builder) WithLenPWQueue(len int) Builder {
 	return b
 }
 
-// WithLog2PageSize sets the log2 of the page size
+// WithNumWalkers sets the number of page table walkers, which is the number of
+// pwqueue entries that can look up the PWC concurrently
+func (b Builder) WithNumWalkers(n int) Builder {
+	b.numWalkers = n
+	return b
+}
+
+// WithLookupLatency sets the number of cycles a request waits in the pwqueue
+// before looking up the PWC
+func (b Builder) WithLookupLatency(cycles int) Builder {
+	b.lookupLatency = cycles
+	return b
+}
+
+// WithLevelLatency sets the number of cycles the low module spends on each
+// page-table level that a walk has to access
+func (b Builder) WithLevelLatency(cycles int) Builder {
+	b.levelLatency = cycles
+	return b
+}
+
+// WithLog2PageSize sets the log2 of the page size. Unless WithPageSize is also
+// used, the page size is derived from it.
 func (b Builder) WithLog2PageSize(n uint64) Builder {
 	b.log2PageSize = n
+	b.log2Set = true
+	return b
+}
+
+// WithPartitionMode sets how the ways of a set are shared among the
+// page-table levels.
+func (b Builder) WithPartitionMode(mode PartitionMode) Builder {
+	b.partitionMode = mode
+	return b
+}
+
+// WithReservedWays sets the number of ways per set reserved for the L4, L3 and
+// L2 entries. With adaptive partitioning, the sum is the budget of ways that
+// is redistributed among the levels; a zero sum uses half of the ways.
+func (b Builder) WithReservedWays(l4, l3, l2 int) Builder {
+	b.reservedWays[LevelL4] = l4
+	b.reservedWays[LevelL3] = l3
+	b.reservedWays[LevelL2] = l2
+	return b
+}
+
+// WithCostWeights sets the weights of the L4, L3 and L2 entries under
+// cost-aware replacement. By default, an L4 entry weighs three level
+// latencies, an L3 entry two, and an L2 entry one, as an entry of an upper
+// level serves the walks of every address under its larger prefix.
+func (b Builder) WithCostWeights(l4, l3, l2 int) Builder {
+	b.costWeights[LevelL4] = l4
+	b.costWeights[LevelL3] = l3
+	b.costWeights[LevelL2] = l2
+	b.costWeightsSet = true
+	return b
+}
+
+// WithPartitionEpoch sets the number of lookups between two redistributions
+// of the reserved ways under adaptive partitioning.
+func (b Builder) WithPartitionEpoch(n uint64) Builder {
+	b.partitionEpoch = n
+	return b
+}
+
+// WithInsertionPolicy sets which levels of a completed walk are inserted into
+// the PWC.
+func (b Builder) WithInsertionPolicy(policy InsertionPolicy) Builder {
+	b.insertion = policy
+	return b
+}
+
+// WithMaxPinnedWays sets the maximum number of ways per set that pin requests
+// can protect from eviction. At least one way of each set always stays
+// evictable.
+func (b Builder) WithMaxPinnedWays(n int) Builder {
+	b.maxPinnedWays = n
+	return b
+}
+
+// WithArbitrationPolicy sets how requests from different devices that share
+// the PWC are served.
+func (b Builder) WithArbitrationPolicy(policy ArbitrationPolicy) Builder {
+	b.arbitration = policy
+	return b
+}
+
+// WithDeviceWeight sets the number of requests that a device can have served
+// per round under weighted arbitration. Devices without a weight use 1.
+func (b Builder) WithDeviceWeight(deviceID uint64, weight int) Builder {
+	weights := make(map[uint64]int, len(b.deviceWeights)+1)
+	for id, w := range b.deviceWeights {
+		weights[id] = w
+	}
+	weights[deviceID] = weight
+
+	b.deviceWeights = weights
+	return b
+}
+
+// WithDeviceQueueSize sets the number of requests that can wait in the queue
+// of each device when arbitration is enabled.
+func (b Builder) WithDeviceQueueSize(n int) Builder {
+	b.devQueueSize = n
+	return b
+}
+
+// WithSharingPolicy sets how the PWC resources are divided among devices.
+func (b Builder) WithSharingPolicy(policy SharingPolicy) Builder {
+	b.sharing = policy
+	return b
+}
+
+// WithDeviceWayQuota sets the maximum number of ways per set that the walks of
+// a single device can fill under the way-quota sharing policy.
+func (b Builder) WithDeviceWayQuota(n int) Builder {
+	b.deviceWayQuota = n
+	return b
+}
+
+// WithTopPortBufferSizes creates one top port per element, each able to
+// buffer the given number of incoming requests. The first port is named Top
+// and the others Top[1], Top[2], and so on. By default, a single top port
+// buffers numReqPerCycle requests.
+func (b Builder) WithTopPortBufferSizes(sizes ...int) Builder {
+	b.topBufSizes = sizes
+	return b
+}
+
+// WithInvariantCheck makes the PWC verify its internal invariants at the end
+// of every tick and pass each violation to the handler. Use PanicOnViolation
+// to stop at the first violation.
+func (b Builder) WithInvariantCheck(handler ViolationHandler) Builder {
+	b.onViolation = handler
+	return b
+}
+
+// WithLookupMode sets whether the PWC reports the hit levels found in its sets
+// or behaves as an ideal or a disabled PWC.
+func (b Builder) WithLookupMode(mode LookupMode) Builder {
+	b.lookupMode = mode
+	return b
+}
+
+// WithRecorder makes the PWC record every translation request that it
+// receives. The recorder is closed when the engine finishes.
+func (b Builder) WithRecorder(r *Recorder) Builder {
+	b.recorder = r
+	return b
+}
+
+// WithMissClassification makes the PWC classify the misses of its lookups as
+// compulsory, capacity, or conflict misses, with a fully-associative shadow of
+// the sets.
+func (b Builder) WithMissClassification(enabled bool) Builder {
+	b.missClass = enabled
+	return b
+}
+
+// WithReuseProfiling makes the PWC profile the stack reuse distances of the
+// prefixes that its lookups access.
+func (b Builder) WithReuseProfiling(enabled bool) Builder {
+	b.reuseProfiling = enabled
+	return b
+}
+
+// WithReplacementPolicy sets how a fill selects the way to evict.
+func (b Builder) WithReplacementPolicy(policy ReplacementPolicy) Builder {
+	b.replacement = policy
+	return b
+}
+
+// WithOracle sets the sequence of translations that the OPT replacement
+// policy looks ahead in.
+func (b Builder) WithOracle(o *Oracle) Builder {
+	b.oracle = o
 	return b
 }
 
-// Build creates a new TLB
+// WithShadow adds a shadow tag array that observes the lookups and fills of
+// the PWC. Each call adds one more.
+func (b Builder) WithShadow(c ShadowConfig) Builder {
+	b.shadows = append(append([]ShadowConfig(nil), b.shadows...), c)
+	return b
+}
+
+// Build creates a new TLB. It panics if the parameters are inconsistent; use
+// BuildE to handle the error instead.
 func (b Builder) Build(name string) *PWC {
+	tlb, err := b.BuildE(name)
+	if err != nil {
+		log.Panicf("cannot build %s: %v", name, err)
+	}
+
+	return tlb
+}
+
+// BuildE creates a new TLB, or returns an error that describes every
+// inconsistent parameter.
+func (b Builder) BuildE(name string) (*PWC, error) {
+	b, err := b.derive()
+	if b.engine == nil {
+		err = errors.Join(err, errors.New("an engine is required"))
+	}
+	if b.lowModule == nil {
+		err = errors.Join(err, errors.New("a low module is required"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	tlb := &PWC{}
 	tlb.TickingComponent =
 		sim.NewTickingComponent(name, b.engine, b.freq, tlb)
@@ -111,18 +357,213 @@ func (b Builder) Build(name string) *PWC {
 	tlb.mshr = newMSHR(b.numMSHREntry)
 	tlb.pwqueue = pwqueue.NewPWQueue(b.lenpwqueue)
 	tlb.log2PageSize = b.log2PageSize
+	tlb.numWalkers = b.numWalkers
+	tlb.lookupLatency = b.lookupLatency
+	tlb.levelLatency = b.levelLatency
+	tlb.partition = newWayPartition(b.partitionMode, b.numWays,
+		b.reservedWays, b.partitionEpoch)
+	tlb.insertion = b.insertion
+	tlb.replacement = b.replacement
+	if b.replacement == ReplacementDueling {
+		tlb.dueling = newSetDueling(b.numSets)
+	}
+	tlb.costWeights = b.costWeights
+	if !b.costWeightsSet {
+		for _, level := range cachedLevels {
+			tlb.costWeights[level] = (numLevels - level) * b.levelLatency
+		}
+	}
+	if b.needsOracle() {
+		tlb.future = newFutureUses(b.oracle, tlb)
+	}
+	for _, c := range b.shadows {
+		tlb.shadows = append(tlb.shadows, tlb.newShadow(c))
+	}
+	tlb.reuseFilter = newReuseFilter(b.numSets * b.numWays)
+	tlb.maxPinnedWays = min(b.maxPinnedWays, b.numWays-1)
+	tlb.numMSHREntry = b.numMSHREntry
+	tlb.sharing = b.sharing
+	tlb.deviceWayQuota = b.deviceWayQuota
+	tlb.onViolation = b.onViolation
+	tlb.lookupMode = b.lookupMode
+	tlb.recorder = b.recorder
+	if b.missClass {
+		tlb.missClassifier = newMissClassifier(b.numSets * b.numWays)
+	}
+	if b.reuseProfiling {
+		tlb.reuseProfiler = newReuseProfiler()
+	}
+	if b.recorder != nil {
+		b.engine.RegisterSimulationEndHandler(b.recorder)
+	}
+	if b.arbitration != ArbitrationNone {
+		tlb.arbiter = newDeviceArbiter(b.arbitration, b.devQueueSize,
+			b.deviceWeights)
+	}
 
 	b.createPorts(name, tlb)
 
 	tlb.reset()
 
-	return tlb
+	return tlb, nil
+}
+
+// derive completes the parameters that can be computed from others and
+// validates the result.
+func (b Builder) derive() (Builder, error) {
+	switch {
+	case b.pageSizeSet && !b.log2Set:
+		b.log2PageSize = uint64(bits.TrailingZeros64(b.pageSize))
+	case b.log2Set && !b.pageSizeSet && b.log2PageSize < 64:
+		b.pageSize = 1 << b.log2PageSize
+	}
+
+	if err := b.validate(); err != nil {
+		return b, err
+	}
+
+	return b, nil
+}
+
+// needsOracle checks if the PWC or one of its shadows uses OPT replacement.
+func (b Builder) needsOracle() bool {
+	if b.replacement == ReplacementOPT {
+		return true
+	}
+
+	for _, c := range b.shadows {
+		if c.Replacement == ReplacementOPT {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validate returns an error that lists every inconsistent parameter.
+func (b Builder) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(b.numSets > 0, "number of sets must be positive, got %d", b.numSets)
+	check(b.numWays > 0, "number of ways must be positive, got %d", b.numWays)
+	check(b.pageSize != 0 && b.pageSize&(b.pageSize-1) == 0,
+		"page size %d is not a power of 2", b.pageSize)
+	check(b.log2PageSize+27 < 64,
+		"log2 page size %d leaves no room for the L4 index", b.log2PageSize)
+	check(b.pageSize == 0 || b.log2PageSize >= 64 ||
+		b.pageSize == 1<<b.log2PageSize,
+		"page size %d is not 2^%d", b.pageSize, b.log2PageSize)
+	check(b.freq > 0, "frequency must be positive, got %v", b.freq)
+	check(isNamed(insertionPolicyNames, b.insertion),
+		"unknown insertion policy %d", b.insertion)
+	check(isNamed(replacementPolicyNames, b.replacement),
+		"unknown replacement policy %d", b.replacement)
+	check(isNamed(partitionModeNames, b.partitionMode),
+		"unknown partition mode %d", b.partitionMode)
+	check(isNamed(arbitrationPolicyNames, b.arbitration),
+		"unknown arbitration policy %d", b.arbitration)
+	check(isNamed(sharingPolicyNames, b.sharing),
+		"unknown sharing policy %d", b.sharing)
+	check(isNamed(lookupModeNames, b.lookupMode),
+		"unknown lookup mode %d", b.lookupMode)
+	check(!b.needsOracle() || b.oracle != nil,
+		"OPT replacement needs an oracle")
+	check(b.replacement != ReplacementDueling || b.numSets >= 3,
+		"set dueling needs at least 3 sets, got %d", b.numSets)
+	check(b.numReqPerCycle > 0,
+		"number of requests per cycle must be positive, got %d",
+		b.numReqPerCycle)
+	check(b.numMSHREntry > 0,
+		"number of MSHR entries must be positive, got %d", b.numMSHREntry)
+	check(b.lenpwqueue >= b.numMSHREntry,
+		"pwqueue length %d is shorter than the %d MSHR entries",
+		b.lenpwqueue, b.numMSHREntry)
+	check(b.numWalkers > 0,
+		"number of walkers must be positive, got %d", b.numWalkers)
+	check(b.lookupLatency >= 0,
+		"lookup latency must not be negative, got %d", b.lookupLatency)
+	check(b.levelLatency >= 0,
+		"level latency must not be negative, got %d", b.levelLatency)
+
+	for i, size := range b.topBufSizes {
+		check(size > 0, "top port %d buffer size must be positive, got %d",
+			i, size)
+	}
+
+	for i, c := range b.shadows {
+		check(c.NumSets > 0,
+			"shadow %d number of sets must be positive, got %d", i, c.NumSets)
+		check(c.NumWays > 0,
+			"shadow %d number of ways must be positive, got %d", i, c.NumWays)
+		check(isNamed(insertionPolicyNames, c.Insertion),
+			"shadow %d insertion policy %d is unknown", i, c.Insertion)
+		check(isNamed(replacementPolicyNames, c.Replacement),
+			"shadow %d replacement policy %d is unknown", i, c.Replacement)
+		check(c.Replacement != ReplacementDueling || c.NumSets >= 3,
+			"shadow %d set dueling needs at least 3 sets, got %d",
+			i, c.NumSets)
+	}
+
+	reserved := 0
+	for _, level := range cachedLevels {
+		check(b.reservedWays[level] >= 0,
+			"reserved ways of level %s must not be negative, got %d",
+			levelNames[level], b.reservedWays[level])
+		reserved += b.reservedWays[level]
+	}
+	check(reserved <= b.numWays,
+		"%d reserved ways exceed the %d ways of a set", reserved, b.numWays)
+	check(b.partitionMode != PartitionAdaptive || b.partitionEpoch > 0,
+		"adaptive partitioning needs a positive epoch")
+
+	for _, level := range cachedLevels {
+		check(b.costWeights[level] >= 0,
+			"cost weight of level %s must not be negative, got %d",
+			levelNames[level], b.costWeights[level])
+	}
+
+	check(b.maxPinnedWays >= 0,
+		"max pinned ways must not be negative, got %d", b.maxPinnedWays)
+
+	check(b.arbitration == ArbitrationNone || b.devQueueSize > 0,
+		"device queue size must be positive, got %d", b.devQueueSize)
+	for id, w := range b.deviceWeights {
+		check(w > 0, "weight of device %d must be positive, got %d", id, w)
+	}
+	check(b.sharing != SharingFairShare || b.arbitration != ArbitrationNone,
+		"fair-share sharing needs an arbitration policy")
+	check(b.sharing != SharingWayQuota ||
+		(b.deviceWayQuota > 0 && b.deviceWayQuota <= b.numWays),
+		"device way quota must be in [1, %d], got %d",
+		b.numWays, b.deviceWayQuota)
+
+	return errors.Join(errs...)
 }
 
 func (b Builder) createPorts(name string, tlb *PWC) {
-	tlb.topPort = sim.NewLimitNumMsgPort(tlb, b.numReqPerCycle,
-		name+".TopPort")
-	tlb.AddPort("Top", tlb.topPort)
+	topBufSizes := b.topBufSizes
+	if len(topBufSizes) == 0 {
+		topBufSizes = []int{b.numReqPerCycle}
+	}
+
+	for i, size := range topBufSizes {
+		portName := name + ".TopPort"
+		alias := "Top"
+		if i > 0 {
+			portName = fmt.Sprintf("%s.TopPort[%d]", name, i)
+			alias = fmt.Sprintf("Top[%d]", i)
+		}
+
+		port := sim.NewLimitNumMsgPort(tlb, size, portName)
+		tlb.AddPort(alias, port)
+		tlb.topPorts = append(tlb.topPorts, port)
+	}
+	tlb.topPort = tlb.topPorts[0]
 
 	tlb.bottomPort = sim.NewLimitNumMsgPort(tlb, b.numReqPerCycle,
 		name+".BottomPort")
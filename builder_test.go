@@ -0,0 +1,135 @@
+package pwcache
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+// buildableBuilder returns a builder that has the engine and the low module
+// that BuildE requires.
+func buildableBuilder() Builder {
+	engine := sim.NewSerialEngine()
+	return MakeBuilder().
+		WithEngine(engine).
+		WithLowModule(newTestAgent("Low", engine).port)
+}
+
+func TestBuildEDerivesPageSize(t *testing.T) {
+	cases := []struct {
+		name         string
+		b            Builder
+		pageSize     uint64
+		log2PageSize uint64
+	}{
+		{"default", buildableBuilder(), 4096, 12},
+		{"page size", buildableBuilder().WithPageSize(65536), 65536, 16},
+		{"log2", buildableBuilder().WithLog2PageSize(21), 1 << 21, 21},
+		{"both", buildableBuilder().WithPageSize(8192).WithLog2PageSize(13), 8192, 13},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			pwc, err := c.b.BuildE("PWC")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if pwc.pageSize != c.pageSize || pwc.log2PageSize != c.log2PageSize {
+				t.Errorf("page size = %d, 2^%d, want %d, 2^%d",
+					pwc.pageSize, pwc.log2PageSize, c.pageSize, c.log2PageSize)
+			}
+		})
+	}
+}
+
+func TestBuildERejectsInconsistentParameters(t *testing.T) {
+	cases := []struct {
+		name string
+		b    Builder
+		want string
+	}{
+		{"zero sets", buildableBuilder().WithNumSets(0), "sets"},
+		{"zero ways", buildableBuilder().WithNumWays(0), "ways"},
+		{"zero MSHR", buildableBuilder().WithNumMSHREntry(0), "MSHR"},
+		{"short pwqueue", buildableBuilder().WithLenPWQueue(2), "pwqueue"},
+		{"zero walkers", buildableBuilder().WithNumWalkers(0), "walkers"},
+		{"page size", buildableBuilder().WithPageSize(3000), "power of 2"},
+		{"page size and log2",
+			buildableBuilder().WithPageSize(65536).WithLog2PageSize(12), "2^12"},
+		{"reserved ways",
+			buildableBuilder().WithNumWays(4).WithReservedWays(2, 2, 1), "reserved"},
+		{"adaptive epoch",
+			buildableBuilder().
+				WithPartitionMode(PartitionAdaptive).
+				WithPartitionEpoch(0), "epoch"},
+		{"fair share",
+			buildableBuilder().WithSharingPolicy(SharingFairShare), "arbitration"},
+		{"way quota",
+			buildableBuilder().WithSharingPolicy(SharingWayQuota), "quota"},
+		{"OPT without oracle",
+			buildableBuilder().WithReplacementPolicy(ReplacementOPT), "oracle"},
+		{"cost weights",
+			buildableBuilder().WithCostWeights(1, -1, 1), "cost weight"},
+		{"dueling sets",
+			buildableBuilder().
+				WithNumSets(2).
+				WithReplacementPolicy(ReplacementDueling), "3 sets"},
+		{"shadow dueling sets",
+			buildableBuilder().WithShadow(ShadowConfig{
+				NumSets:     2,
+				NumWays:     4,
+				Replacement: ReplacementDueling,
+			}), "shadow 0 set dueling"},
+		{"shadow ways",
+			buildableBuilder().WithShadow(ShadowConfig{NumSets: 1}), "shadow 0"},
+		{"OPT shadow without oracle",
+			buildableBuilder().WithShadow(ShadowConfig{NumSets: 1, NumWays: 4,
+				Replacement: ReplacementOPT}), "oracle"},
+		{"device weight",
+			buildableBuilder().WithDeviceWeight(1, 0), "weight of device 1"},
+		{"top port", buildableBuilder().WithTopPortBufferSizes(4, 0), "top port 1"},
+		{"engine", buildableBuilder().WithEngine(nil), "engine"},
+		{"low module", buildableBuilder().WithLowModule(nil), "low module"},
+		{"insertion",
+			buildableBuilder().WithInsertionPolicy(InsertionPolicy(-1)),
+			"insertion policy -1"},
+		{"replacement",
+			buildableBuilder().WithReplacementPolicy(ReplacementPolicy(9)),
+			"replacement policy 9"},
+		{"lookup mode",
+			buildableBuilder().WithLookupMode(LookupMode(9)), "lookup mode 9"},
+		{"arbitration",
+			buildableBuilder().WithArbitrationPolicy(ArbitrationPolicy(9)),
+			"arbitration policy 9"},
+		{"partition mode",
+			buildableBuilder().WithPartitionMode(PartitionMode(9)),
+			"partition mode 9"},
+		{"sharing",
+			buildableBuilder().WithSharingPolicy(SharingPolicy(9)),
+			"sharing policy 9"},
+		{"shadow replacement",
+			buildableBuilder().WithShadow(ShadowConfig{NumSets: 1, NumWays: 4,
+				Replacement: ReplacementPolicy(9)}), "shadow 0 replacement"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := c.b.BuildE("PWC")
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("err = %v, want one mentioning %q", err, c.want)
+			}
+		})
+	}
+}
+
+func TestBuildPanicsOnInconsistentParameters(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Build accepted zero sets")
+		}
+	}()
+
+	MakeBuilder().WithNumSets(0).Build("PWC")
+}
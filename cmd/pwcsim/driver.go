@@ -0,0 +1,100 @@
+package main
+
+import (
+	"log"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+// A driver stands in for the L2 TLBs above the PWC. It sends copies of the
+// requests of a workload in order, keeping at most window translations in
+// flight, and records the latency of each one in cycles.
+type driver struct {
+	*sim.TickingComponent
+
+	port   sim.Port
+	dst    sim.Port
+	window int
+
+	reqs        []*vm.TranslationReq
+	next        int
+	outstanding map[string]sim.VTimeInSec
+	latencies   []uint64
+}
+
+func newDriver(
+	name string,
+	engine sim.Engine,
+	freq sim.Freq,
+	window int,
+	reqs []*vm.TranslationReq,
+) *driver {
+	d := &driver{
+		window:      window,
+		reqs:        reqs,
+		outstanding: make(map[string]sim.VTimeInSec),
+	}
+	d.TickingComponent = sim.NewTickingComponent(name, engine, freq, d)
+	d.port = sim.NewLimitNumMsgPort(d, window, name+".Port")
+	d.AddPort("Port", d.port)
+
+	return d
+}
+
+// start schedules the first tick. dst is the port that receives the requests.
+func (d *driver) start(dst sim.Port) {
+	d.dst = dst
+	d.TickLater(0)
+}
+
+// Tick collects the responses and sends as many requests as the window allows.
+func (d *driver) Tick(now sim.VTimeInSec) bool {
+	madeProgress := false
+
+	for d.port.Peek() != nil {
+		d.receive(now, d.port.Retrieve(now))
+		madeProgress = true
+	}
+
+	for d.next < len(d.reqs) && len(d.outstanding) < d.window {
+		r := d.reqs[d.next]
+		req := vm.TranslationReqBuilder{}.
+			WithSendTime(now).
+			WithSrc(d.port).
+			WithDst(d.dst).
+			WithPID(r.PID).
+			WithVAddr(r.VAddr).
+			WithDeviceID(r.DeviceID).
+			Build()
+		if d.port.Send(req) != nil {
+			break
+		}
+
+		d.outstanding[req.ID] = now
+		d.next++
+		madeProgress = true
+	}
+
+	return madeProgress
+}
+
+func (d *driver) receive(now sim.VTimeInSec, msg sim.Msg) {
+	rsp, ok := msg.(*vm.TranslationRsp)
+	if !ok {
+		log.Panicf("driver cannot handle %T", msg)
+	}
+
+	sent, found := d.outstanding[rsp.RespondTo]
+	if !found {
+		log.Panicf("response to unknown request %s", rsp.RespondTo)
+	}
+
+	delete(d.outstanding, rsp.RespondTo)
+	d.latencies = append(d.latencies, d.Freq.Cycle(now)-d.Freq.Cycle(sent))
+}
+
+// done tells whether every request has been answered.
+func (d *driver) done() bool {
+	return d.next == len(d.reqs) && len(d.outstanding) == 0
+}
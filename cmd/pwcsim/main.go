@@ -0,0 +1,271 @@
+// Command pwcsim simulates a PWC in front of a page table emulator and reports
+// the hit levels and translation latencies of a workload. Comma-separated
+// lists of parameters are swept in parallel and every combination becomes a
+// row of the result table.
+//
+//	pwcsim -workload random -n 100000 -sets 1,4 -ways 8,16,32 -insertion all,missing -replacement lru,opt
+package main
+
+import (
+	"encoding"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Sam-Yang6/pwcache"
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "pwcsim:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("pwcsim", flag.ContinueOnError)
+	configPath := fs.String("config", "",
+		"JSON or YAML file with the base PWC configuration")
+	sets := fs.String("sets", "", "numbers of sets to sweep")
+	ways := fs.String("ways", "", "numbers of ways to sweep")
+	walkers := fs.String("walkers", "", "numbers of walkers to sweep")
+	mshr := fs.String("mshr", "", "numbers of MSHR entries to sweep")
+	insertion := fs.String("insertion", "", "insertion policies to sweep")
+	replacement := fs.String("replacement", "",
+		"replacement policies to sweep")
+	pattern := fs.String("workload", "random",
+		"synthetic workload: stream, strided, random or power-law")
+	tracePath := fs.String("trace", "",
+		"JSON-lines trace to replay instead of a synthetic workload")
+	numReqs := fs.Int("n", 10000, "number of synthetic translations")
+	footprint := fs.Uint64("footprint", 1<<30,
+		"bytes of virtual memory that the synthetic workload touches")
+	stride := fs.Uint64("stride", 1<<21, "bytes between strided accesses")
+	alpha := fs.Float64("alpha", 1.2, "exponent of the power-law workload")
+	numPIDs := fs.Int("pids", 1, "number of processes of the synthetic workload")
+	chunk := fs.Int("chunk", 1,
+		"consecutive translations of a process before the next one's turn")
+	seed := fs.Int64("seed", 1, "seed of the synthetic workload")
+	window := fs.Int("window", 16, "translations in flight from the driver")
+	parallel := fs.Int("j", runtime.NumCPU(), "simulations to run in parallel")
+	format := fs.String("format", "table", "result format: table or csv")
+	outPath := fs.String("o", "", "file to write the results to")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	base := pwcache.MakeBuilder()
+	if *configPath != "" {
+		var err error
+		if base, err = base.WithConfigFile(*configPath); err != nil {
+			return err
+		}
+	}
+	cfg := base.Config()
+
+	var a axes
+	var err error
+	if a.numSets, err = parseInts(*sets, cfg.NumSets); err != nil {
+		return fmt.Errorf("-sets: %w", err)
+	}
+	if a.numWays, err = parseInts(*ways, cfg.NumWays); err != nil {
+		return fmt.Errorf("-ways: %w", err)
+	}
+	if a.numWalkers, err = parseInts(*walkers, cfg.NumWalkers); err != nil {
+		return fmt.Errorf("-walkers: %w", err)
+	}
+	if a.numMSHREntry, err = parseInts(*mshr, cfg.NumMSHREntry); err != nil {
+		return fmt.Errorf("-mshr: %w", err)
+	}
+	if a.insertion, err = parsePolicies(*insertion, cfg.Insertion); err != nil {
+		return fmt.Errorf("-insertion: %w", err)
+	}
+	a.replacement, err = parsePolicies(*replacement, cfg.Replacement)
+	if err != nil {
+		return fmt.Errorf("-replacement: %w", err)
+	}
+
+	if *window <= 0 || *parallel <= 0 {
+		return fmt.Errorf("-window and -j must be positive")
+	}
+
+	var reqs []*vm.TranslationReq
+	if *tracePath != "" {
+		reqs, err = readTrace(*tracePath)
+	} else {
+		reqs, err = synthesize(workloadParams{
+			pattern:   *pattern,
+			numReqs:   *numReqs,
+			footprint: *footprint,
+			pageSize:  cfg.PageSize,
+			stride:    *stride,
+			alpha:     *alpha,
+			numPIDs:   *numPIDs,
+			chunk:     *chunk,
+			seed:      *seed,
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	s := simulator{
+		base:   base,
+		freq:   1 * sim.GHz,
+		window: *window,
+		reqs:   reqs,
+	}
+	for _, r := range a.replacement {
+		if r == pwcache.ReplacementOPT {
+			s.base = s.base.WithOracle(s.oracle())
+			break
+		}
+	}
+
+	results, err := s.sweep(a.points(), *parallel)
+	if err != nil {
+		return err
+	}
+
+	out := stdout
+	if *outPath != "" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	switch *format {
+	case "table":
+		return writeTable(out, results)
+	case "csv":
+		return writeCSV(out, results)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+// parseInts parses a comma-separated list of integers. An empty list stands
+// for def.
+func parseInts(s string, def int) ([]int, error) {
+	if s == "" {
+		return []int{def}, nil
+	}
+
+	var values []int
+	for _, field := range strings.Split(s, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+// parsePolicies parses a comma-separated list of policy names. An empty list
+// stands for def.
+func parsePolicies[T any, PT interface {
+	*T
+	encoding.TextUnmarshaler
+}](s string, def T) ([]T, error) {
+	if s == "" {
+		return []T{def}, nil
+	}
+
+	var values []T
+	for _, field := range strings.Split(s, ",") {
+		var v T
+		if err := PT(&v).UnmarshalText([]byte(strings.TrimSpace(field))); err != nil {
+			return nil, err
+		}
+
+		values = append(values, v)
+	}
+
+	return values, nil
+}
+
+func policyName(p encoding.TextMarshaler) string {
+	text, err := p.MarshalText()
+	if err != nil {
+		return fmt.Sprint(p)
+	}
+
+	return string(text)
+}
+
+var resultHeader = []string{
+	"sets", "ways", "walkers", "mshr", "insertion", "replacement", "lookups",
+	"l2", "l3", "l4", "miss", "mean", "p50", "p99",
+	"queue", "lookup", "low-module", "respond", "cycles",
+}
+
+func (r result) row() []string {
+	p := r.point
+	row := []string{
+		strconv.Itoa(p.numSets),
+		strconv.Itoa(p.numWays),
+		strconv.Itoa(p.numWalkers),
+		strconv.Itoa(p.numMSHREntry),
+		policyName(p.insertion),
+		policyName(p.replacement),
+		strconv.FormatUint(r.stats.Lookups, 10),
+		strconv.FormatFloat(r.hitRate(pwcache.LevelL2), 'f', 4, 64),
+		strconv.FormatFloat(r.hitRate(pwcache.LevelL3), 'f', 4, 64),
+		strconv.FormatFloat(r.hitRate(pwcache.LevelL4), 'f', 4, 64),
+		strconv.FormatFloat(r.hitRate(pwcache.LevelNone), 'f', 4, 64),
+		strconv.FormatFloat(r.meanLatency(), 'f', 1, 64),
+		strconv.FormatUint(r.percentile(0.5), 10),
+		strconv.FormatUint(r.percentile(0.99), 10),
+	}
+
+	for _, h := range r.phases.Phases {
+		row = append(row, strconv.FormatFloat(h.Mean(), 'f', 1, 64))
+	}
+
+	return append(row, strconv.FormatUint(r.cycles, 10))
+}
+
+// writeTable writes the results as an aligned table. Hit rates are fractions
+// of the lookups and latencies are in cycles. The queue, lookup, low-module,
+// and respond columns are the mean cycles spent in each phase.
+func writeTable(w io.Writer, results []result) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, strings.Join(resultHeader, "\t")+"\t")
+	for _, r := range results {
+		fmt.Fprintln(tw, strings.Join(r.row(), "\t")+"\t")
+	}
+
+	return tw.Flush()
+}
+
+// writeCSV writes the results with a header line.
+func writeCSV(w io.Writer, results []result) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(resultHeader); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		if err := cw.Write(r.row()); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/Sam-Yang6/pwcache"
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+// A point is one combination of the swept parameters.
+type point struct {
+	numSets      int
+	numWays      int
+	numWalkers   int
+	numMSHREntry int
+	insertion    pwcache.InsertionPolicy
+	replacement  pwcache.ReplacementPolicy
+}
+
+// axes lists the values to sweep for each parameter.
+type axes struct {
+	numSets      []int
+	numWays      []int
+	numWalkers   []int
+	numMSHREntry []int
+	insertion    []pwcache.InsertionPolicy
+	replacement  []pwcache.ReplacementPolicy
+}
+
+// points returns the cartesian product of the axes.
+func (a axes) points() []point {
+	var points []point
+	for _, sets := range a.numSets {
+		for _, ways := range a.numWays {
+			for _, walkers := range a.numWalkers {
+				for _, mshr := range a.numMSHREntry {
+					for _, insertion := range a.insertion {
+						for _, replacement := range a.replacement {
+							points = append(points, point{sets, ways,
+								walkers, mshr, insertion, replacement})
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return points
+}
+
+// apply sets the parameters of the point on top of b.
+func (p point) apply(b pwcache.Builder) pwcache.Builder {
+	return b.
+		WithNumSets(p.numSets).
+		WithNumWays(p.numWays).
+		WithNumWalkers(p.numWalkers).
+		WithNumMSHREntry(p.numMSHREntry).
+		WithInsertionPolicy(p.insertion).
+		WithReplacementPolicy(p.replacement)
+}
+
+// A result holds the statistics of the simulation of a point.
+type result struct {
+	point     point
+	stats     pwcache.Stats
+	phases    pwcache.Latencies
+	numReqs   int
+	latencies []uint64
+	cycles    uint64
+}
+
+// meanLatency returns the average translation latency in cycles.
+func (r result) meanLatency() float64 {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+
+	var sum uint64
+	for _, l := range r.latencies {
+		sum += l
+	}
+
+	return float64(sum) / float64(len(r.latencies))
+}
+
+// percentile returns the latency below which a fraction q of the
+// translations completed.
+func (r result) percentile(q float64) uint64 {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+
+	sorted := append([]uint64(nil), r.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	i := int(q * float64(len(sorted)-1))
+	return sorted[i]
+}
+
+// hitRate returns the fraction of the lookups that hit the level.
+func (r result) hitRate(level int) float64 {
+	if r.stats.Lookups == 0 {
+		return 0
+	}
+
+	return float64(r.stats.LevelHits[level]) / float64(r.stats.Lookups)
+}
+
+// simulator runs the simulation of single points.
+type simulator struct {
+	base   pwcache.Builder
+	freq   sim.Freq
+	window int
+	reqs   []*vm.TranslationReq
+}
+
+// run simulates the point with a fresh engine, PWC, page table emulator and
+// driver.
+func (s simulator) run(p point) (result, error) {
+	engine := sim.NewSerialEngine()
+	log2PageSize := s.base.Config().Log2PageSize
+
+	emu := pwcache.MakeEmulatorBuilder().
+		WithEngine(engine).
+		WithFreq(s.freq).
+		WithLog2PageSize(log2PageSize).
+		WithOnDemandMapping(0x100000000).
+		Build("Emu")
+	emuPort := emu.GetPortByName("Top")
+
+	pwc, err := p.apply(s.base).
+		WithEngine(engine).
+		WithFreq(s.freq).
+		WithLowModule(emuPort).
+		BuildE("PWC")
+	if err != nil {
+		return result{}, err
+	}
+
+	drv := newDriver("Driver", engine, s.freq, s.window, s.reqs)
+
+	conn := sim.NewDirectConnection("Conn", engine, s.freq)
+	conn.PlugIn(drv.port, s.window)
+	conn.PlugIn(emuPort, 4)
+	for _, port := range pwc.Ports() {
+		conn.PlugIn(port, 4)
+	}
+
+	drv.start(pwc.GetPortByName("Top"))
+	if err := engine.Run(); err != nil {
+		return result{}, err
+	}
+
+	if !drv.done() {
+		return result{}, fmt.Errorf("%d of %d translations did not complete",
+			len(s.reqs)-len(drv.latencies), len(s.reqs))
+	}
+
+	return result{
+		point:     p,
+		stats:     pwc.Stats(),
+		phases:    pwc.Latencies(),
+		numReqs:   len(s.reqs),
+		latencies: drv.latencies,
+		cycles:    s.freq.Cycle(engine.CurrentTime()),
+	}, nil
+}
+
+// oracle returns an Oracle of the requests that the driver sends, in order.
+func (s simulator) oracle() *pwcache.Oracle {
+	accesses := make([]pwcache.Access, len(s.reqs))
+	for i, req := range s.reqs {
+		accesses[i] = pwcache.Access{PID: req.PID, VAddr: req.VAddr}
+	}
+
+	return pwcache.NewOracle(accesses)
+}
+
+// sweep simulates every point with at most parallel simulations at a time.
+// The results are in the order of the points.
+func (s simulator) sweep(points []point, parallel int) ([]result, error) {
+	results := make([]result, len(points))
+	errs := make([]error, len(points))
+
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i], errs[i] = s.run(points[i])
+			}
+		}()
+	}
+
+	for i := range points {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", points[i], err)
+		}
+	}
+
+	return results, nil
+}
+
+// String describes the point in the form used in error messages.
+func (p point) String() string {
+	return fmt.Sprintf(
+		"sets=%d ways=%d walkers=%d mshr=%d insertion=%s replacement=%s",
+		p.numSets, p.numWays, p.numWalkers, p.numMSHREntry,
+		policyName(p.insertion), policyName(p.replacement))
+}
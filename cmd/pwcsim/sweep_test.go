@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunSweepsEveryCombination(t *testing.T) {
+	var out bytes.Buffer
+	err := run([]string{
+		"-n", "200", "-workload", "power-law", "-pids", "2",
+		"-sets", "1,2", "-ways", "4,8",
+		"-insertion", "all,missing", "-format", "csv", "-j", "3",
+	}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1+8 {
+		t.Fatalf("got %d lines, want a header and 8 rows:\n%s",
+			len(lines), out.String())
+	}
+
+	if !strings.HasPrefix(lines[1], "1,4,8,4,all,lru,") {
+		t.Errorf("first row = %q, want the first combination", lines[1])
+	}
+}
+
+func TestRunSweepsSetsOnConflictingWorkload(t *testing.T) {
+	var out bytes.Buffer
+	err := run([]string{
+		"-n", "500", "-workload", "strided",
+		"-stride", "2097152", "-footprint", "16777216",
+		"-sets", "1,4", "-ways", "4", "-format", "csv", "-j", "2",
+	}, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1+2 {
+		t.Fatalf("got %d lines, want a header and 2 rows:\n%s",
+			len(lines), out.String())
+	}
+
+	oneSet := strings.SplitN(lines[1], ",", 2)[1]
+	fourSets := strings.SplitN(lines[2], ",", 2)[1]
+	if oneSet == fourSets {
+		t.Errorf("1 and 4 sets gave the same results:\n%s", out.String())
+	}
+}
+
+func TestRunReportsInvalidPoints(t *testing.T) {
+	err := run([]string{"-n", "10", "-ways", "8,0"}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "ways=0") {
+		t.Errorf("err = %v, want one naming the invalid point", err)
+	}
+}
+
+func TestRunRejectsUnalignedStrides(t *testing.T) {
+	err := run([]string{"-n", "10", "-workload", "strided", "-stride", "100"},
+		&bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "multiple of the page size") {
+		t.Errorf("err = %v, want one about the page size", err)
+	}
+}
+
+func TestDecodeTrace(t *testing.T) {
+	trace := `{"pid": 1, "vaddr": 4096, "device_id": 2}
+
+{"pid": 2, "vaddr": 8192}
+`
+	reqs, err := decodeTrace(strings.NewReader(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reqs) != 2 {
+		t.Fatalf("got %d requests, want 2", len(reqs))
+	}
+
+	if reqs[0].PID != 1 || reqs[0].VAddr != 4096 || reqs[0].DeviceID != 2 ||
+		reqs[1].PID != 2 || reqs[1].VAddr != 8192 {
+		t.Errorf("requests = %+v, %+v", *reqs[0], *reqs[1])
+	}
+
+	if _, err := decodeTrace(strings.NewReader(`{"pid": 1}`)); err == nil {
+		t.Error("accepted a line without vaddr")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Sam-Yang6/pwcache/workload"
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+// workloadParams describes a synthetic workload.
+type workloadParams struct {
+	pattern   string
+	numReqs   int
+	footprint uint64
+	pageSize  uint64
+	stride    uint64
+	alpha     float64
+	numPIDs   int
+	chunk     int
+	seed      int64
+}
+
+// synthesize generates the requests of a synthetic workload. Each process
+// has its own generator, seeded differently, and the processes take turns
+// every chunk requests.
+func synthesize(p workloadParams) ([]*vm.TranslationReq, error) {
+	switch {
+	case p.numPIDs <= 0 || p.chunk <= 0:
+		return nil, fmt.Errorf("processes and chunk must be positive")
+	case p.footprint < p.pageSize:
+		return nil, fmt.Errorf("footprint %d is smaller than a page", p.footprint)
+	case p.pattern == "strided" && (p.stride == 0 || p.stride%p.pageSize != 0):
+		return nil, fmt.Errorf(
+			"stride %d is not a positive multiple of the page size %d",
+			p.stride, p.pageSize)
+	case p.pattern == "power-law" && p.alpha <= 1:
+		return nil, fmt.Errorf("power-law exponent must be greater than 1")
+	}
+
+	var gens []workload.Generator
+	for i := 0; i < p.numPIDs; i++ {
+		b := workload.MakeBuilder().
+			WithPID(vm.PID(i + 1)).
+			WithFootprint(p.footprint).
+			WithPageSize(p.pageSize).
+			WithSeed(p.seed + int64(i))
+
+		switch p.pattern {
+		case "stream":
+			gens = append(gens, b.BuildStream())
+		case "strided":
+			gens = append(gens, b.BuildStrided(p.stride))
+		case "random":
+			gens = append(gens, b.BuildRandom())
+		case "power-law":
+			gens = append(gens, b.BuildPowerLaw(p.alpha))
+		default:
+			return nil, fmt.Errorf("unknown workload %q", p.pattern)
+		}
+	}
+
+	return workload.Take(workload.Interleave(p.chunk, gens...), p.numReqs), nil
+}
+
+// traceRecord is a line of a JSON-lines trace. Fields other than the PID, the
+// virtual address, and the device are ignored.
+type traceRecord struct {
+	PID      *vm.PID `json:"pid"`
+	VAddr    *uint64 `json:"vaddr"`
+	DeviceID uint64  `json:"device_id"`
+}
+
+// readTrace reads the requests in the JSON-lines trace at path.
+func readTrace(path string) ([]*vm.TranslationReq, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reqs, err := decodeTrace(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return reqs, nil
+}
+
+func decodeTrace(r io.Reader) ([]*vm.TranslationReq, error) {
+	var reqs []*vm.TranslationReq
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var rec traceRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if rec.PID == nil || rec.VAddr == nil {
+			return nil, fmt.Errorf("line %d: missing pid or vaddr", line)
+		}
+
+		reqs = append(reqs, vm.TranslationReqBuilder{}.
+			WithPID(*rec.PID).
+			WithVAddr(*rec.VAddr).
+			WithDeviceID(rec.DeviceID).
+			Build())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return reqs, nil
+}
@@ -0,0 +1,359 @@
+package pwcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// A Config holds the parameters of a PWC in a form that can be decoded from
+// JSON or YAML files. Policies are written by name, for example
+// "partition": "static" or "insertion": "bypass-low-reuse".
+type Config struct {
+	NumSets            int               `json:"num_sets" yaml:"num_sets"`
+	NumWays            int               `json:"num_ways" yaml:"num_ways"`
+	PageSize           uint64            `json:"page_size" yaml:"page_size"`
+	Log2PageSize       uint64            `json:"log2_page_size" yaml:"log2_page_size"`
+	NumReqPerCycle     int               `json:"num_req_per_cycle" yaml:"num_req_per_cycle"`
+	NumMSHREntry       int               `json:"num_mshr_entry" yaml:"num_mshr_entry"`
+	LenPWQueue         int               `json:"len_pwqueue" yaml:"len_pwqueue"`
+	NumWalkers         int               `json:"num_walkers" yaml:"num_walkers"`
+	LookupLatency      int               `json:"lookup_latency" yaml:"lookup_latency"`
+	LevelLatency       int               `json:"level_latency" yaml:"level_latency"`
+	TopPortBufferSizes []int             `json:"top_port_buffer_sizes" yaml:"top_port_buffer_sizes"`
+	Partition          PartitionMode     `json:"partition" yaml:"partition"`
+	ReservedWays       ReservedWays      `json:"reserved_ways" yaml:"reserved_ways"`
+	PartitionEpoch     uint64            `json:"partition_epoch" yaml:"partition_epoch"`
+	Insertion          InsertionPolicy   `json:"insertion" yaml:"insertion"`
+	Replacement        ReplacementPolicy `json:"replacement" yaml:"replacement"`
+	CostWeights        *CostWeights      `json:"cost_weights,omitempty" yaml:"cost_weights,omitempty"`
+	MaxPinnedWays      int               `json:"max_pinned_ways" yaml:"max_pinned_ways"`
+	Arbitration        ArbitrationPolicy `json:"arbitration" yaml:"arbitration"`
+	DeviceWeights      map[uint64]int    `json:"device_weights" yaml:"device_weights"`
+	DeviceQueueSize    int               `json:"device_queue_size" yaml:"device_queue_size"`
+	Sharing            SharingPolicy     `json:"sharing" yaml:"sharing"`
+	DeviceWayQuota     int               `json:"device_way_quota" yaml:"device_way_quota"`
+	LookupMode         LookupMode        `json:"lookup_mode" yaml:"lookup_mode"`
+	MissClassification bool              `json:"miss_classification" yaml:"miss_classification"`
+	ReuseProfiling     bool              `json:"reuse_profiling" yaml:"reuse_profiling"`
+	Shadows            []ShadowConfig    `json:"shadows" yaml:"shadows"`
+}
+
+// ReservedWays is the number of ways per set reserved for each level.
+type ReservedWays struct {
+	L4 int `json:"l4" yaml:"l4"`
+	L3 int `json:"l3" yaml:"l3"`
+	L2 int `json:"l2" yaml:"l2"`
+}
+
+// CostWeights is the weight of the entries of each level under cost-aware
+// replacement. A nil *CostWeights in a Config stands for the default weights.
+type CostWeights struct {
+	L4 int `json:"l4" yaml:"l4"`
+	L3 int `json:"l3" yaml:"l3"`
+	L2 int `json:"l2" yaml:"l2"`
+}
+
+// Config returns the parameters currently set in the Builder. Decoding a file
+// into the returned Config leaves the parameters absent from the file
+// unchanged.
+func (b Builder) Config() Config {
+	c := Config{
+		NumSets:            b.numSets,
+		NumWays:            b.numWays,
+		PageSize:           b.pageSize,
+		Log2PageSize:       b.log2PageSize,
+		NumReqPerCycle:     b.numReqPerCycle,
+		NumMSHREntry:       b.numMSHREntry,
+		LenPWQueue:         b.lenpwqueue,
+		NumWalkers:         b.numWalkers,
+		LookupLatency:      b.lookupLatency,
+		LevelLatency:       b.levelLatency,
+		Partition:          b.partitionMode,
+		PartitionEpoch:     b.partitionEpoch,
+		Insertion:          b.insertion,
+		Replacement:        b.replacement,
+		MaxPinnedWays:      b.maxPinnedWays,
+		Arbitration:        b.arbitration,
+		DeviceQueueSize:    b.devQueueSize,
+		Sharing:            b.sharing,
+		DeviceWayQuota:     b.deviceWayQuota,
+		LookupMode:         b.lookupMode,
+		MissClassification: b.missClass,
+		ReuseProfiling:     b.reuseProfiling,
+		ReservedWays: ReservedWays{
+			L4: b.reservedWays[LevelL4],
+			L3: b.reservedWays[LevelL3],
+			L2: b.reservedWays[LevelL2],
+		},
+	}
+
+	if b.costWeightsSet {
+		c.CostWeights = &CostWeights{
+			L4: b.costWeights[LevelL4],
+			L3: b.costWeights[LevelL3],
+			L2: b.costWeights[LevelL2],
+		}
+	}
+
+	c.TopPortBufferSizes = append([]int(nil), b.topBufSizes...)
+	c.Shadows = append([]ShadowConfig(nil), b.shadows...)
+
+	c.DeviceWeights = make(map[uint64]int, len(b.deviceWeights))
+	for id, w := range b.deviceWeights {
+		c.DeviceWeights[id] = w
+	}
+
+	return c
+}
+
+// WithConfig applies all the parameters in c. A page size or log2 page size
+// that differs from the current one is handled as if set by WithPageSize or
+// WithLog2PageSize, so that the other one is derived. WithConfig returns an
+// error that describes every inconsistent parameter, in which case the
+// Builder is returned unchanged.
+func (b Builder) WithConfig(c Config) (Builder, error) {
+	n := b.
+		WithNumSets(c.NumSets).
+		WithNumWays(c.NumWays).
+		WithNumReqPerCycle(c.NumReqPerCycle).
+		WithNumMSHREntry(c.NumMSHREntry).
+		WithLenPWQueue(c.LenPWQueue).
+		WithNumWalkers(c.NumWalkers).
+		WithLookupLatency(c.LookupLatency).
+		WithLevelLatency(c.LevelLatency).
+		WithTopPortBufferSizes(c.TopPortBufferSizes...).
+		WithPartitionMode(c.Partition).
+		WithReservedWays(c.ReservedWays.L4, c.ReservedWays.L3,
+			c.ReservedWays.L2).
+		WithPartitionEpoch(c.PartitionEpoch).
+		WithInsertionPolicy(c.Insertion).
+		WithReplacementPolicy(c.Replacement).
+		WithMaxPinnedWays(c.MaxPinnedWays).
+		WithArbitrationPolicy(c.Arbitration).
+		WithDeviceQueueSize(c.DeviceQueueSize).
+		WithSharingPolicy(c.Sharing).
+		WithDeviceWayQuota(c.DeviceWayQuota).
+		WithLookupMode(c.LookupMode).
+		WithMissClassification(c.MissClassification).
+		WithReuseProfiling(c.ReuseProfiling)
+
+	if c.PageSize != b.pageSize {
+		n = n.WithPageSize(c.PageSize)
+	}
+
+	if c.Log2PageSize != b.log2PageSize {
+		n = n.WithLog2PageSize(c.Log2PageSize)
+	}
+
+	n.costWeights, n.costWeightsSet = [numLevels]int{}, false
+	if c.CostWeights != nil {
+		n = n.WithCostWeights(c.CostWeights.L4, c.CostWeights.L3,
+			c.CostWeights.L2)
+	}
+
+	n.deviceWeights = nil
+	for id, w := range c.DeviceWeights {
+		n = n.WithDeviceWeight(id, w)
+	}
+
+	n.shadows = nil
+	for _, sc := range c.Shadows {
+		n = n.WithShadow(sc)
+	}
+
+	n, err := n.derive()
+	if err != nil {
+		return b, err
+	}
+
+	return n, nil
+}
+
+// WithConfigJSON decodes a JSON configuration from r and applies it on top of
+// the parameters already set. Unknown fields are reported as errors.
+func (b Builder) WithConfigJSON(r io.Reader) (Builder, error) {
+	c := b.Config()
+
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return b, fmt.Errorf("cannot decode JSON configuration: %w", err)
+	}
+
+	return b.WithConfig(c)
+}
+
+// WithConfigYAML decodes a YAML configuration from r and applies it on top of
+// the parameters already set. Unknown fields are reported as errors.
+func (b Builder) WithConfigYAML(r io.Reader) (Builder, error) {
+	c := b.Config()
+
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return b, fmt.Errorf("cannot decode YAML configuration: %w", err)
+	}
+
+	return b.WithConfig(c)
+}
+
+// WithConfigFile applies the configuration in the file at path. Files ending
+// in .yaml or .yml are decoded as YAML and all others as JSON.
+func (b Builder) WithConfigFile(path string) (Builder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return b, err
+	}
+
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		b, err = b.WithConfigYAML(bytes.NewReader(data))
+	default:
+		b, err = b.WithConfigJSON(bytes.NewReader(data))
+	}
+
+	if err != nil {
+		return b, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return b, nil
+}
+
+var partitionModeNames = map[PartitionMode]string{
+	PartitionNone:     "none",
+	PartitionStatic:   "static",
+	PartitionAdaptive: "adaptive",
+}
+
+var insertionPolicyNames = map[InsertionPolicy]string{
+	InsertAll:            "all",
+	InsertMissing:        "missing",
+	InsertLowest:         "lowest",
+	InsertBypassLowReuse: "bypass-low-reuse",
+}
+
+var replacementPolicyNames = map[ReplacementPolicy]string{
+	ReplacementLRU:       "lru",
+	ReplacementOPT:       "opt",
+	ReplacementBIP:       "bip",
+	ReplacementDueling:   "dueling",
+	ReplacementCostAware: "cost-aware",
+}
+
+var arbitrationPolicyNames = map[ArbitrationPolicy]string{
+	ArbitrationNone:       "none",
+	ArbitrationRoundRobin: "round-robin",
+	ArbitrationWeighted:   "weighted",
+}
+
+var sharingPolicyNames = map[SharingPolicy]string{
+	SharingNone:      "none",
+	SharingFairShare: "fair-share",
+	SharingWayQuota:  "way-quota",
+}
+
+var lookupModeNames = map[LookupMode]string{
+	LookupNormal:   "normal",
+	LookupIdeal:    "ideal",
+	LookupDisabled: "disabled",
+}
+
+// isNamed checks if v is one of the values of an enum.
+func isNamed[T comparable](names map[T]string, v T) bool {
+	_, found := names[v]
+	return found
+}
+
+func marshalName[T comparable](names map[T]string, v T) ([]byte, error) {
+	name, found := names[v]
+	if !found {
+		return nil, fmt.Errorf("unknown value %v", v)
+	}
+
+	return []byte(name), nil
+}
+
+func unmarshalName[T comparable](names map[T]string, text []byte, v *T) error {
+	for value, name := range names {
+		if name == string(text) {
+			*v = value
+			return nil
+		}
+	}
+
+	valid := make([]string, 0, len(names))
+	for _, name := range names {
+		valid = append(valid, name)
+	}
+	sort.Strings(valid)
+
+	return fmt.Errorf("unknown value %q, want one of %v", text, valid)
+}
+
+// MarshalText encodes the mode by name.
+func (m PartitionMode) MarshalText() ([]byte, error) {
+	return marshalName(partitionModeNames, m)
+}
+
+// UnmarshalText decodes the mode from its name.
+func (m *PartitionMode) UnmarshalText(text []byte) error {
+	return unmarshalName(partitionModeNames, text, m)
+}
+
+// MarshalText encodes the policy by name.
+func (p InsertionPolicy) MarshalText() ([]byte, error) {
+	return marshalName(insertionPolicyNames, p)
+}
+
+// UnmarshalText decodes the policy from its name.
+func (p *InsertionPolicy) UnmarshalText(text []byte) error {
+	return unmarshalName(insertionPolicyNames, text, p)
+}
+
+// MarshalText encodes the policy by name.
+func (p ReplacementPolicy) MarshalText() ([]byte, error) {
+	return marshalName(replacementPolicyNames, p)
+}
+
+// UnmarshalText decodes the policy from its name.
+func (p *ReplacementPolicy) UnmarshalText(text []byte) error {
+	return unmarshalName(replacementPolicyNames, text, p)
+}
+
+// MarshalText encodes the policy by name.
+func (p ArbitrationPolicy) MarshalText() ([]byte, error) {
+	return marshalName(arbitrationPolicyNames, p)
+}
+
+// UnmarshalText decodes the policy from its name.
+func (p *ArbitrationPolicy) UnmarshalText(text []byte) error {
+	return unmarshalName(arbitrationPolicyNames, text, p)
+}
+
+// MarshalText encodes the policy by name.
+func (p SharingPolicy) MarshalText() ([]byte, error) {
+	return marshalName(sharingPolicyNames, p)
+}
+
+// UnmarshalText decodes the policy from its name.
+func (p *SharingPolicy) UnmarshalText(text []byte) error {
+	return unmarshalName(sharingPolicyNames, text, p)
+}
+
+// MarshalText encodes the mode by name.
+func (m LookupMode) MarshalText() ([]byte, error) {
+	return marshalName(lookupModeNames, m)
+}
+
+// UnmarshalText decodes the mode from its name.
+func (m *LookupMode) UnmarshalText(text []byte) error {
+	return unmarshalName(lookupModeNames, text, m)
+}
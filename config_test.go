@@ -0,0 +1,156 @@
+package pwcache
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithConfigJSONKeepsAbsentParameters(t *testing.T) {
+	b, err := MakeBuilder().WithNumWays(16).WithConfigJSON(strings.NewReader(`{
+		"num_sets": 4,
+		"partition": "static",
+		"reserved_ways": {"l4": 2, "l3": 2, "l2": 4},
+		"insertion": "bypass-low-reuse"
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := b.Config()
+	if c.NumSets != 4 || c.NumWays != 16 || c.NumMSHREntry != 4 {
+		t.Errorf("got %d sets, %d ways, %d MSHR entries, want 4, 16, 4",
+			c.NumSets, c.NumWays, c.NumMSHREntry)
+	}
+
+	if c.Partition != PartitionStatic || c.Insertion != InsertBypassLowReuse {
+		t.Errorf("policies were not decoded: %+v", c)
+	}
+
+	if c.ReservedWays != (ReservedWays{L4: 2, L3: 2, L2: 4}) {
+		t.Errorf("reserved ways = %+v", c.ReservedWays)
+	}
+}
+
+func TestWithConfigFileDecodesYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwc.yaml")
+	err := os.WriteFile(path, []byte(
+		"num_ways: 8\n"+
+			"num_walkers: 16\n"+
+			"arbitration: weighted\n"+
+			"device_weights: {1: 3}\n"+
+			"lookup_mode: ideal\n"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := MakeBuilder().WithConfigFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := b.Config()
+	if c.NumWays != 8 || c.NumWalkers != 16 || c.NumSets != 1 {
+		t.Errorf("got %d ways, %d walkers, %d sets, want 8, 16, 1",
+			c.NumWays, c.NumWalkers, c.NumSets)
+	}
+
+	if c.Arbitration != ArbitrationWeighted || c.DeviceWeights[1] != 3 ||
+		c.LookupMode != LookupIdeal {
+		t.Errorf("policies were not decoded: %+v", c)
+	}
+}
+
+func TestWithConfigReportsInconsistentParameters(t *testing.T) {
+	_, err := MakeBuilder().WithConfigJSON(strings.NewReader(`{
+		"num_ways": 4,
+		"page_size": 65536,
+		"log2_page_size": 13,
+		"reserved_ways": {"l4": 2, "l3": 2, "l2": 2}
+	}`))
+	if err == nil {
+		t.Fatal("inconsistent configuration was accepted")
+	}
+
+	for _, want := range []string{"page size 65536 is not 2^13", "reserved ways"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestWithConfigRejectsUnknownNames(t *testing.T) {
+	_, err := MakeBuilder().WithConfigJSON(
+		strings.NewReader(`{"insertion": "sometimes"}`))
+	if err == nil || !strings.Contains(err.Error(), "bypass-low-reuse") {
+		t.Errorf("err = %v, want the valid insertion policies", err)
+	}
+
+	_, err = MakeBuilder().WithConfigJSON(strings.NewReader(`{"num_set": 2}`))
+	if err == nil {
+		t.Error("unknown field was accepted")
+	}
+}
+
+func TestConfigRoundTripsEveryField(t *testing.T) {
+	want := Config{
+		NumSets:            4,
+		NumWays:            16,
+		PageSize:           8192,
+		Log2PageSize:       13,
+		NumReqPerCycle:     2,
+		NumMSHREntry:       8,
+		LenPWQueue:         32,
+		NumWalkers:         4,
+		LookupLatency:      5,
+		LevelLatency:       50,
+		TopPortBufferSizes: []int{4, 8},
+		Partition:          PartitionAdaptive,
+		ReservedWays:       ReservedWays{L4: 1, L3: 2, L2: 3},
+		PartitionEpoch:     64,
+		Insertion:          InsertMissing,
+		Replacement:        ReplacementBIP,
+		CostWeights:        &CostWeights{L4: 3, L3: 2, L2: 1},
+		MaxPinnedWays:      2,
+		Arbitration:        ArbitrationWeighted,
+		DeviceWeights:      map[uint64]int{1: 2},
+		DeviceQueueSize:    4,
+		Sharing:            SharingWayQuota,
+		DeviceWayQuota:     8,
+		LookupMode:         LookupIdeal,
+		MissClassification: true,
+		ReuseProfiling:     true,
+		Shadows:            []ShadowConfig{{NumSets: 2, NumWays: 4}},
+	}
+
+	v := reflect.ValueOf(want)
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			t.Fatalf("field %s is not set by the test", v.Type().Field(i).Name)
+		}
+	}
+
+	b, err := MakeBuilder().WithConfig(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := b.Config(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Config() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWithConfigJSONKeepsReplacementPolicy(t *testing.T) {
+	b, err := MakeBuilder().
+		WithReplacementPolicy(ReplacementBIP).
+		WithConfigJSON(strings.NewReader(`{"num_ways": 8}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := b.Config().Replacement; got != ReplacementBIP {
+		t.Errorf("replacement = %v, want bip", got)
+	}
+}
@@ -0,0 +1,237 @@
+package pwcache
+
+import (
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+// ArbitrationPolicy selects how a PWC shared by several devices picks the
+// next request to look up in the MSHR.
+type ArbitrationPolicy int
+
+// Arbitration policies supported by the PWC.
+const (
+	// ArbitrationNone serves requests in the order they arrive at the top
+	// port, regardless of the device that sent them.
+	ArbitrationNone ArbitrationPolicy = iota
+
+	// ArbitrationRoundRobin queues requests per device and serves one
+	// request of each device in turn.
+	ArbitrationRoundRobin
+
+	// ArbitrationWeighted queues requests per device and serves as many
+	// requests of each device per round as its weight.
+	ArbitrationWeighted
+)
+
+// SharingPolicy selects how the PWC resources are divided among devices.
+type SharingPolicy int
+
+// Sharing policies supported by the PWC.
+const (
+	// SharingNone lets all devices compete freely.
+	SharingNone SharingPolicy = iota
+
+	// SharingFairShare limits each device to an equal share of the MSHR
+	// entries among the devices that have requests in flight. It requires
+	// an arbitration policy other than ArbitrationNone.
+	SharingFairShare
+
+	// SharingWayQuota limits the number of ways per set that the walks of a
+	// device can fill.
+	SharingWayQuota
+)
+
+type deviceQueue struct {
+	deviceID uint64
+	reqs     []*vm.TranslationReq
+	credit   int
+}
+
+// deviceArbiter buffers the requests from the top port per device and picks
+// the device to serve next.
+type deviceArbiter struct {
+	policy    ArbitrationPolicy
+	queueSize int
+	weights   map[uint64]int
+
+	queues  []*deviceQueue
+	byID    map[uint64]*deviceQueue
+	next    int
+	current *deviceQueue
+}
+
+func newDeviceArbiter(
+	policy ArbitrationPolicy,
+	queueSize int,
+	weights map[uint64]int,
+) *deviceArbiter {
+	return &deviceArbiter{
+		policy:    policy,
+		queueSize: queueSize,
+		weights:   weights,
+		byID:      make(map[uint64]*deviceQueue),
+	}
+}
+
+func (a *deviceArbiter) weight(deviceID uint64) int {
+	w, found := a.weights[deviceID]
+	if a.policy != ArbitrationWeighted || !found || w < 1 {
+		return 1
+	}
+
+	return w
+}
+
+func (a *deviceArbiter) queue(deviceID uint64) *deviceQueue {
+	q, found := a.byID[deviceID]
+	if !found {
+		q = &deviceQueue{deviceID: deviceID, credit: a.weight(deviceID)}
+		a.byID[deviceID] = q
+		a.queues = append(a.queues, q)
+	}
+
+	return q
+}
+
+func (a *deviceArbiter) canAccept(req *vm.TranslationReq) bool {
+	return len(a.queue(req.DeviceID).reqs) < a.queueSize
+}
+
+func (a *deviceArbiter) accept(req *vm.TranslationReq) {
+	q := a.queue(req.DeviceID)
+	q.reqs = append(q.reqs, req)
+}
+
+// peek returns the head request of the next device in turn whose head request
+// is eligible. The device stays selected until the request is retrieved. If
+// only the devices that have used their credits can be served, a new round
+// starts, so that the lookup never idles while a request is eligible.
+func (a *deviceArbiter) peek(eligible func(*vm.TranslationReq) bool) *vm.TranslationReq {
+	a.current = nil
+
+	q := a.nextEligible(eligible, true)
+	if q == nil && a.nextEligible(eligible, false) != nil {
+		for _, dq := range a.queues {
+			dq.credit = a.weight(dq.deviceID)
+		}
+
+		q = a.nextEligible(eligible, true)
+	}
+
+	if q == nil {
+		return nil
+	}
+
+	a.current = q
+	return q.reqs[0]
+}
+
+// nextEligible moves the turn to the next device whose head request is
+// eligible, considering only the devices with credits left if withCredit is
+// set, and returns its queue. It returns nil if there is no such device.
+func (a *deviceArbiter) nextEligible(
+	eligible func(*vm.TranslationReq) bool,
+	withCredit bool,
+) *deviceQueue {
+	for i := 0; i < len(a.queues); i++ {
+		q := a.queues[(a.next+i)%len(a.queues)]
+		if len(q.reqs) == 0 || (withCredit && q.credit == 0) ||
+			!eligible(q.reqs[0]) {
+			continue
+		}
+
+		if withCredit {
+			a.next = (a.next + i) % len(a.queues)
+		}
+
+		return q
+	}
+
+	return nil
+}
+
+// retrieve removes the request returned by the last peek.
+func (a *deviceArbiter) retrieve() *vm.TranslationReq {
+	q := a.current
+	req := q.reqs[0]
+	q.reqs = q.reqs[1:]
+
+	q.credit--
+	if q.credit == 0 || len(q.reqs) == 0 {
+		a.next = (a.next + 1) % len(a.queues)
+	}
+
+	a.current = nil
+	return req
+}
+
+func (a *deviceArbiter) reset() {
+	for _, q := range a.queues {
+		q.reqs = nil
+		q.credit = a.weight(q.deviceID)
+	}
+
+	a.current = nil
+}
+
+// numActiveDevices returns the number of devices that have queued requests or
+// MSHR entries.
+func (pwc *PWC) numActiveDevices() int {
+	active := make(map[uint64]bool)
+	for _, q := range pwc.arbiter.queues {
+		if len(q.reqs) > 0 {
+			active[q.deviceID] = true
+		}
+	}
+
+	for _, e := range pwc.mshr.AllEntries() {
+		active[e.deviceID] = true
+	}
+
+	return len(active)
+}
+
+func (pwc *PWC) numMSHREntriesOf(deviceID uint64) int {
+	n := 0
+	for _, e := range pwc.mshr.AllEntries() {
+		if e.deviceID == deviceID {
+			n++
+		}
+	}
+
+	return n
+}
+
+// withinMSHRShare checks if the request can be served without taking its
+// device beyond its fair share of the MSHR.
+func (pwc *PWC) withinMSHRShare(req *vm.TranslationReq) bool {
+	if pwc.sharing != SharingFairShare {
+		return true
+	}
+
+	if pwc.mshr.Query(req.PID, req.VAddr) != nil {
+		return true
+	}
+
+	share := pwc.numMSHREntry / max(pwc.numActiveDevices(), 1)
+	return pwc.numMSHREntriesOf(req.DeviceID) < max(share, 1)
+}
+
+// deviceQuotaFilter returns a predicate that accepts the ways of set that a
+// fill on behalf of the device may evict without exceeding its way quota.
+func (pwc *PWC) deviceQuotaFilter(set Set, deviceID uint64) func(wayID int) bool {
+	occupancy := 0
+	for wayID := 0; wayID < pwc.numWays; wayID++ {
+		if set.Level(wayID) != LevelNone && set.Owner(wayID) == deviceID {
+			occupancy++
+		}
+	}
+
+	if occupancy < pwc.deviceWayQuota {
+		return func(int) bool { return true }
+	}
+
+	return func(wayID int) bool {
+		return set.Level(wayID) != LevelNone && set.Owner(wayID) == deviceID
+	}
+}
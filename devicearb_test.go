@@ -0,0 +1,186 @@
+package pwcache
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+type hookFunc func(ctx sim.HookCtx)
+
+func (f hookFunc) Func(ctx sim.HookCtx) {
+	f(ctx)
+}
+
+// walkSources returns the source of every walk that reached the low module,
+// in arrival order, given the device or the port that sent each address.
+func (h *pwcHarness) walkSources(sourceOf map[uint64]uint64) []uint64 {
+	var sources []uint64
+	for _, req := range h.low.received {
+		sources = append(sources, sourceOf[req.VAddr])
+	}
+
+	return sources
+}
+
+func TestArbitrationOrdersDevices(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		b    Builder
+		want []uint64
+	}{
+		{"round robin",
+			MakeBuilder().WithArbitrationPolicy(ArbitrationRoundRobin),
+			[]uint64{1, 2, 1, 2, 1, 2, 1, 2}},
+		{"weighted",
+			MakeBuilder().
+				WithArbitrationPolicy(ArbitrationWeighted).
+				WithDeviceWeight(1, 3),
+			[]uint64{1, 1, 1, 2, 1, 2, 2, 2}},
+	} {
+		h := newPWCHarness(t, tc.b.
+			WithNumMSHREntry(8).
+			WithNumReqPerCycle(1).
+			WithTopPortBufferSizes(8))
+		deviceOf := make(map[uint64]uint64)
+		for _, deviceID := range []uint64{1, 2} {
+			for i := uint64(0); i < 4; i++ {
+				vAddr := baseVAddr + otherL4VAddr*(4*deviceID+i)
+				deviceOf[vAddr] = deviceID
+				h.translateFrom(deviceID, 1, vAddr)
+			}
+		}
+		h.run()
+
+		if got := h.walkSources(deviceOf); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: walks by device %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestArbiterSkipsDeviceBlockedByFullMSHR(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().
+		WithNumMSHREntry(1).
+		WithArbitrationPolicy(ArbitrationRoundRobin))
+	req0 := h.translateFrom(0, 1, baseVAddr)
+	req1 := h.translateFrom(1, 1, otherL4VAddr)
+	req2 := h.translateFrom(2, 1, baseVAddr)
+	h.run()
+
+	if len(h.low.received) != 2 {
+		t.Errorf("low module received %d walks, want 2", len(h.low.received))
+	}
+
+	rsps := h.top.translationRsps()
+	if len(rsps) != 3 {
+		t.Fatalf("got %d responses, want 3", len(rsps))
+	}
+
+	var got []string
+	for _, rsp := range rsps {
+		got = append(got, rsp.RespondTo)
+	}
+
+	if want := []string{req0.ID, req2.ID, req1.ID}; !reflect.DeepEqual(got, want) {
+		t.Errorf("responses to %v, want %v", got, want)
+	}
+}
+
+func TestWeightedArbiterServesSingleEligibleDevice(t *testing.T) {
+	a := newDeviceArbiter(ArbitrationWeighted, 8, map[uint64]int{2: 3})
+	for i := 0; i < 3; i++ {
+		a.accept(vm.TranslationReqBuilder{}.WithDeviceID(1).Build())
+	}
+	a.accept(vm.TranslationReqBuilder{}.WithDeviceID(2).Build())
+
+	onlyDevice1 := func(req *vm.TranslationReq) bool {
+		return req.DeviceID == 1
+	}
+	for i := 0; i < 3; i++ {
+		if a.peek(onlyDevice1) == nil {
+			t.Fatalf("request %d of device 1 was not served", i)
+		}
+		a.retrieve()
+	}
+
+	if a.peek(onlyDevice1) != nil {
+		t.Error("served a request that is not eligible")
+	}
+}
+
+func TestFairShareLimitsMSHREntriesPerDevice(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().
+		WithNumMSHREntry(4).
+		WithTopPortBufferSizes(8).
+		WithArbitrationPolicy(ArbitrationRoundRobin).
+		WithSharingPolicy(SharingFairShare))
+	maxEntries := 0
+	h.pwc.AcceptHook(hookFunc(func(ctx sim.HookCtx) {
+		if ctx.Pos == HookPosLookup {
+			maxEntries = max(maxEntries, h.pwc.numMSHREntriesOf(1))
+		}
+	}))
+
+	for i := uint64(0); i < 4; i++ {
+		h.translateFrom(1, 1, baseVAddr+otherL4VAddr*i)
+	}
+	h.translateFrom(2, 1, baseVAddr+otherL4VAddr*4)
+	h.run()
+
+	if maxEntries != 2 {
+		t.Errorf("device 1 held up to %d MSHR entries, want 2", maxEntries)
+	}
+
+	if len(h.top.translationRsps()) != 5 {
+		t.Errorf("got %d responses, want 5", len(h.top.translationRsps()))
+	}
+}
+
+func TestWayQuotaLimitsWaysPerDevice(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().
+		WithNumWays(4).
+		WithSharingPolicy(SharingWayQuota).
+		WithDeviceWayQuota(2))
+	h.translateFrom(1, 1, baseVAddr)
+	h.run()
+	h.translateFrom(2, 1, otherL4VAddr)
+	h.run()
+
+	var owned [3]int
+	set := h.pwc.Sets[0]
+	for wayID := 0; wayID < 4; wayID++ {
+		if set.Level(wayID) != LevelNone {
+			owned[set.Owner(wayID)]++
+		}
+	}
+
+	if owned != [3]int{0, 2, 2} {
+		t.Errorf("ways per device = %v, want [0 2 2]", owned)
+	}
+}
+
+func TestArbiterAcceptsFromTopPortsInTurn(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().
+		WithTopPortBufferSizes(4, 4).
+		WithNumReqPerCycle(1).
+		WithArbitrationPolicy(ArbitrationRoundRobin).
+		WithDeviceQueueSize(2))
+
+	portOf := make(map[uint64]uint64)
+	for portID := uint64(0); portID < 2; portID++ {
+		for i := uint64(0); i < 4; i++ {
+			vAddr := baseVAddr + otherL4VAddr*(4*portID+i)
+			portOf[vAddr] = portID
+			req := h.translate(1, vAddr)
+			req.Dst = h.pwc.topPorts[portID]
+		}
+	}
+	h.run()
+
+	want := []uint64{0, 1, 0, 1, 0, 1, 0, 1}
+	if got := h.walkSources(portOf); !reflect.DeepEqual(got, want) {
+		t.Errorf("walks by port %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+package pwcache
+
+const (
+	// duelingCounterMax is the largest value of the 10-bit policy selector.
+	duelingCounterMax = 1<<10 - 1
+
+	// duelingPeriod is the number of consecutive sets among which one is an
+	// LRU leader and one a BIP leader.
+	duelingPeriod = 32
+
+	// bipThrottle is the number of BIP fills per fill inserted as the most
+	// recently visited.
+	bipThrottle = 32
+)
+
+// DuelingPolicyStats holds the counters of a policy under set dueling.
+type DuelingPolicyStats struct {
+	// Probes and Misses count the lookups of the leader sets of the policy,
+	// one per level probed.
+	Probes uint64
+	Misses uint64
+
+	// Fills counts the entries inserted under the policy, in its leader sets
+	// and in the followers while it is selected.
+	Fills uint64
+}
+
+// MissRate returns the fraction of the probes of the leader sets that missed.
+func (s DuelingPolicyStats) MissRate() float64 {
+	if s.Probes == 0 {
+		return 0
+	}
+
+	return float64(s.Misses) / float64(s.Probes)
+}
+
+// A DuelingState describes the set dueling between LRU and BIP. Counter moves
+// up on every miss of an LRU leader set and down on every miss of a BIP
+// leader set, saturating at 0 and CounterMax. The follower sets use BIP while
+// Counter is in the upper half. The lookups of WarmUp move Counter as the
+// timed ones do, and ResetStats clears the counters of the policies but keeps
+// Counter, so that the timed run starts with the policy that the warm-up
+// selected.
+type DuelingState struct {
+	Counter    int
+	CounterMax int
+	Selected   ReplacementPolicy
+	LRU        DuelingPolicyStats
+	BIP        DuelingPolicyStats
+}
+
+// DuelingState returns the state of the set dueling. It is empty unless the
+// PWC uses ReplacementDueling.
+func (pwc *PWC) DuelingState() DuelingState {
+	d := pwc.dueling
+	if d == nil {
+		return DuelingState{}
+	}
+
+	return DuelingState{
+		Counter:    d.counter,
+		CounterMax: duelingCounterMax,
+		Selected:   d.selected(),
+		LRU:        d.lru,
+		BIP:        d.bip,
+	}
+}
+
+// setDueling selects the insertion policy of each set.
+type setDueling struct {
+	period  int
+	counter int
+	lru     DuelingPolicyStats
+	bip     DuelingPolicyStats
+}
+
+func newSetDueling(numSets int) *setDueling {
+	return &setDueling{
+		period:  min(numSets, duelingPeriod),
+		counter: duelingCounterMax / 2,
+	}
+}
+
+// leaderStats returns the counters of the policy that the set leads for, or
+// nil if the set is a follower.
+func (d *setDueling) leaderStats(setID int) *DuelingPolicyStats {
+	switch setID % d.period {
+	case 0:
+		return &d.lru
+	case d.period / 2:
+		return &d.bip
+	default:
+		return nil
+	}
+}
+
+func (d *setDueling) selected() ReplacementPolicy {
+	if d.counter > duelingCounterMax/2 {
+		return ReplacementBIP
+	}
+
+	return ReplacementLRU
+}
+
+// policyOf returns the policy that the set inserts entries with.
+func (d *setDueling) policyOf(setID int) ReplacementPolicy {
+	switch d.leaderStats(setID) {
+	case &d.lru:
+		return ReplacementLRU
+	case &d.bip:
+		return ReplacementBIP
+	default:
+		return d.selected()
+	}
+}
+
+// recordProbe accounts a lookup of the set for one level.
+func (d *setDueling) recordProbe(setID int, hit bool) {
+	stats := d.leaderStats(setID)
+	if stats == nil {
+		return
+	}
+
+	stats.Probes++
+	if hit {
+		return
+	}
+
+	stats.Misses++
+	if stats == &d.lru {
+		d.counter = min(d.counter+1, duelingCounterMax)
+	} else {
+		d.counter = max(d.counter-1, 0)
+	}
+}
+
+// recordFill accounts an entry inserted under the policy.
+func (d *setDueling) recordFill(policy ReplacementPolicy) {
+	if policy == ReplacementBIP {
+		d.bip.Fills++
+	} else {
+		d.lru.Fills++
+	}
+}
+
+// reset clears the counters of the policies and keeps the selector.
+func (d *setDueling) reset() {
+	d.lru = DuelingPolicyStats{}
+	d.bip = DuelingPolicyStats{}
+}
+
+// placeFill makes the way that a fill has just written the most recently
+// visited one or, under BIP, the least recently visited one.
+func (pwc *PWC) placeFill(set Set, setID, wayID int) {
+	policy := pwc.replacement
+	if pwc.dueling != nil {
+		policy = pwc.dueling.policyOf(setID)
+		pwc.dueling.recordFill(policy)
+	}
+
+	if policy == ReplacementBIP {
+		pwc.numBIPFills++
+		if pwc.numBIPFills%bipThrottle != 0 {
+			set.Demote(wayID)
+			return
+		}
+	}
+
+	set.Visit(wayID)
+}
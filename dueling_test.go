@@ -0,0 +1,87 @@
+package pwcache
+
+import (
+	"testing"
+)
+
+func TestSetDuelingFollowsTheLeaderThatMissesLess(t *testing.T) {
+	d := newSetDueling(4)
+	if d.policyOf(0) != ReplacementLRU || d.policyOf(2) != ReplacementBIP {
+		t.Fatalf("leaders = %v, %v, want lru, bip", d.policyOf(0), d.policyOf(2))
+	}
+
+	if d.policyOf(1) != ReplacementLRU {
+		t.Errorf("followers start with %v, want lru", d.policyOf(1))
+	}
+
+	d.recordProbe(0, false)
+	d.recordProbe(1, false)
+	d.recordProbe(2, true)
+	if d.policyOf(1) != ReplacementBIP || d.policyOf(3) != ReplacementBIP {
+		t.Errorf("followers use %v after an LRU leader miss, want bip",
+			d.policyOf(1))
+	}
+
+	if d.lru.Probes != 1 || d.lru.Misses != 1 || d.bip.Probes != 1 ||
+		d.bip.Misses != 0 {
+		t.Errorf("leader stats = %+v, %+v", d.lru, d.bip)
+	}
+
+	for i := 0; i < 2*duelingCounterMax; i++ {
+		d.recordProbe(2, false)
+	}
+	if d.counter != 0 || d.policyOf(1) != ReplacementLRU {
+		t.Errorf("counter = %d, followers use %v, want 0, lru",
+			d.counter, d.policyOf(1))
+	}
+}
+
+func TestPWCReportsDuelingState(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().
+		WithNumSets(4).
+		WithNumWays(4).
+		WithReplacementPolicy(ReplacementDueling))
+	if got := h.pwc.DuelingState().Selected; got != ReplacementLRU {
+		t.Fatalf("selected %v before any lookup, want LRU", got)
+	}
+
+	// Six L2 prefixes cycle through set 0, the LRU leader, and six through
+	// set 2, the BIP leader. LRU misses all of them, while BIP keeps some.
+	for round := 0; round < 40; round++ {
+		for j := uint64(0); j < 6; j++ {
+			for _, setID := range []uint64{0, 2} {
+				h.translate(1, (4*j+setID)<<21)
+				h.run()
+			}
+		}
+	}
+
+	state := h.pwc.DuelingState()
+	if state.CounterMax != duelingCounterMax {
+		t.Errorf("counter max = %d, want %d", state.CounterMax, duelingCounterMax)
+	}
+
+	if state.LRU.Probes == 0 || state.LRU.Misses == 0 ||
+		state.BIP.Probes == 0 || state.BIP.Misses == 0 {
+		t.Errorf("LRU leaders %+v and BIP leaders %+v, want probes and "+
+			"misses in both", state.LRU, state.BIP)
+	}
+
+	if state.LRU.Misses <= state.BIP.Misses {
+		t.Errorf("LRU leaders missed %d times, BIP %d, want BIP to miss less",
+			state.LRU.Misses, state.BIP.Misses)
+	}
+
+	if state.Selected != ReplacementBIP {
+		t.Errorf("selected %v, want BIP", state.Selected)
+	}
+
+	var fills uint64
+	for _, n := range h.pwc.Stats().Fills {
+		fills += n
+	}
+	if state.LRU.Fills+state.BIP.Fills != fills {
+		t.Errorf("dueling fills = %d + %d, want %d",
+			state.LRU.Fills, state.BIP.Fills, fills)
+	}
+}
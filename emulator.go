@@ -0,0 +1,151 @@
+package pwcache
+
+import (
+	"log"
+	"sort"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+	"github.com/sarchlab/akita/v3/tracing"
+)
+
+// A PageTableEmulator stands in for the GMMU below a PWC. It answers every
+// TranslationReqpwc from an in-memory page table after the number of cycles
+// given by the request's Lantency field.
+type PageTableEmulator struct {
+	*sim.TickingComponent
+
+	topPort sim.Port
+
+	pageTable      vm.PageTable
+	log2PageSize   uint64
+	numReqPerCycle int
+	onDemand       bool
+	nextPAddr      uint64
+
+	walks []*emulatedWalk
+}
+
+type emulatedWalk struct {
+	req     *TranslationReqpwc
+	readyAt sim.VTimeInSec
+}
+
+// Map inserts a translation from the page that contains vAddr to the page
+// that contains pAddr. A page that is already mapped is remapped.
+func (e *PageTableEmulator) Map(pid vm.PID, vAddr, pAddr uint64) {
+	page := vm.Page{
+		PID:      pid,
+		VAddr:    vAddr >> e.log2PageSize << e.log2PageSize,
+		PAddr:    pAddr >> e.log2PageSize << e.log2PageSize,
+		PageSize: uint64(1) << e.log2PageSize,
+		Valid:    true,
+	}
+
+	if _, found := e.pageTable.Find(pid, page.VAddr); found {
+		e.pageTable.Update(page)
+		return
+	}
+
+	e.pageTable.Insert(page)
+}
+
+// MapRange maps every page that overlaps the size bytes starting at vAddr to
+// contiguous physical pages, the first of which contains pAddr.
+func (e *PageTableEmulator) MapRange(pid vm.PID, vAddr, pAddr, size uint64) {
+	pageSize := uint64(1) << e.log2PageSize
+	start := vAddr &^ (pageSize - 1)
+	for page := start; page < vAddr+size; page += pageSize {
+		e.Map(pid, page, pAddr+page-start)
+	}
+}
+
+// PageTable returns the page table that the emulator walks.
+func (e *PageTableEmulator) PageTable() vm.PageTable {
+	return e.pageTable
+}
+
+// Tick defines how the emulator update states at each cycle
+func (e *PageTableEmulator) Tick(now sim.VTimeInSec) bool {
+	madeProgress := false
+
+	for i := 0; i < e.numReqPerCycle; i++ {
+		madeProgress = e.respond(now) || madeProgress
+	}
+
+	for i := 0; i < e.numReqPerCycle; i++ {
+		madeProgress = e.accept(now) || madeProgress
+	}
+
+	return madeProgress || len(e.walks) > 0
+}
+
+func (e *PageTableEmulator) accept(now sim.VTimeInSec) bool {
+	msg := e.topPort.Retrieve(now)
+	if msg == nil {
+		return false
+	}
+
+	req, ok := msg.(*TranslationReqpwc)
+	if !ok {
+		log.Panicf("page table emulator cannot handle %T", msg)
+	}
+
+	walk := &emulatedWalk{
+		req:     req,
+		readyAt: e.Freq.NCyclesLater(req.Lantency, now),
+	}
+
+	i := sort.Search(len(e.walks), func(i int) bool {
+		return e.walks[i].readyAt > walk.readyAt
+	})
+	e.walks = append(e.walks, nil)
+	copy(e.walks[i+1:], e.walks[i:])
+	e.walks[i] = walk
+
+	tracing.TraceReqReceive(req, e)
+
+	return true
+}
+
+func (e *PageTableEmulator) respond(now sim.VTimeInSec) bool {
+	if len(e.walks) == 0 || e.walks[0].readyAt > now {
+		return false
+	}
+
+	req := e.walks[0].req
+	rsp := vm.TranslationRspBuilder{}.
+		WithSendTime(now).
+		WithSrc(e.topPort).
+		WithDst(req.Src).
+		WithRspTo(req.ID).
+		WithPage(e.translate(req.PID, req.VAddr)).
+		Build()
+
+	err := e.topPort.Send(rsp)
+	if err != nil {
+		return false
+	}
+
+	e.walks = e.walks[1:]
+	tracing.TraceReqComplete(req, e)
+
+	return true
+}
+
+func (e *PageTableEmulator) translate(pid vm.PID, vAddr uint64) vm.Page {
+	page, found := e.pageTable.Find(pid, vAddr)
+	if found {
+		return page
+	}
+
+	if !e.onDemand {
+		log.Panicf("page not found for PID %d, VAddr 0x%x", pid, vAddr)
+	}
+
+	e.Map(pid, vAddr, e.nextPAddr)
+	e.nextPAddr += uint64(1) << e.log2PageSize
+	page, _ = e.pageTable.Find(pid, vAddr)
+
+	return page
+}
@@ -0,0 +1,154 @@
+package pwcache
+
+import (
+	"testing"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+func TestPageTableEmulatorAnswersPWCWalks(t *testing.T) {
+	engine := sim.NewSerialEngine()
+	top := newTestAgent("Top", engine)
+	emu := MakeEmulatorBuilder().
+		WithEngine(engine).
+		WithMappedRange(1, 0x10000, 0x80000, 0x2000).
+		Build("Emu")
+	pwc := MakeBuilder().
+		WithEngine(engine).
+		WithLowModule(emu.topPort).
+		Build("PWC")
+
+	conn := sim.NewDirectConnection("Conn", engine, 1*sim.GHz)
+	conn.PlugIn(top.port, 4)
+	conn.PlugIn(pwc.topPort, 4)
+	conn.PlugIn(pwc.bottomPort, 4)
+	conn.PlugIn(emu.topPort, 4)
+
+	top.send(vm.TranslationReqBuilder{}.
+		WithDst(pwc.topPort).
+		WithPID(1).
+		WithVAddr(0x11000).
+		Build())
+	if err := engine.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	rsps := top.translationRsps()
+	if len(rsps) != 1 {
+		t.Fatalf("got %d responses, want 1", len(rsps))
+	}
+
+	if rsps[0].Page.PAddr != 0x81000 {
+		t.Errorf("PAddr = 0x%x, want 0x81000", rsps[0].Page.PAddr)
+	}
+
+	if engine.CurrentTime() < 400*sim.VTimeInSec(1e-9) {
+		t.Errorf("walk finished at %v, before the 400-cycle latency",
+			engine.CurrentTime())
+	}
+}
+
+func TestPageTableEmulatorMapsOnDemand(t *testing.T) {
+	emu := MakeEmulatorBuilder().
+		WithEngine(sim.NewSerialEngine()).
+		WithOnDemandMapping(0x1000000).
+		Build("Emu")
+
+	first := emu.translate(1, 0x5000)
+	second := emu.translate(1, 0x9000)
+	again := emu.translate(1, 0x5000)
+
+	if first.PAddr != 0x1000000 || second.PAddr != 0x1001000 {
+		t.Errorf("PAddrs = 0x%x, 0x%x, want 0x1000000, 0x1001000",
+			first.PAddr, second.PAddr)
+	}
+
+	if again != first {
+		t.Error("the same page was mapped twice")
+	}
+}
+
+func TestPageTableEmulatorMapsUnalignedRanges(t *testing.T) {
+	emu := MakeEmulatorBuilder().
+		WithEngine(sim.NewSerialEngine()).
+		Build("Emu")
+	emu.MapRange(1, 0x10800, 0x80000, 0x1000)
+
+	for vAddr, want := range map[uint64]uint64{
+		0x10800: 0x80000,
+		0x11400: 0x81000,
+	} {
+		page, found := emu.PageTable().Find(1, vAddr)
+		if !found || page.PAddr != want {
+			t.Errorf("page of 0x%x = %+v, %v, want PAddr 0x%x",
+				vAddr, page, found, want)
+		}
+	}
+
+	if _, found := emu.PageTable().Find(1, 0x12000); found {
+		t.Error("mapped a page past the end of the range")
+	}
+}
+
+func TestPageTableEmulatorRemapsOverlappingRanges(t *testing.T) {
+	emu := MakeEmulatorBuilder().
+		WithEngine(sim.NewSerialEngine()).
+		Build("Emu")
+	emu.MapRange(1, 0x10000, 0x80000, 0x2000)
+	emu.MapRange(1, 0x11000, 0x90000, 0x2000)
+
+	for vAddr, want := range map[uint64]uint64{
+		0x10000: 0x80000,
+		0x11000: 0x90000,
+		0x12000: 0x91000,
+	} {
+		page, found := emu.PageTable().Find(1, vAddr)
+		if !found || page.PAddr != want {
+			t.Errorf("page of 0x%x = %+v, %v, want PAddr 0x%x",
+				vAddr, page, found, want)
+		}
+	}
+}
+
+func TestPWCAnswersUnalignedAddressesThroughEmulator(t *testing.T) {
+	engine := sim.NewSerialEngine()
+	top := newTestAgent("Top", engine)
+	emu := MakeEmulatorBuilder().
+		WithEngine(engine).
+		WithOnDemandMapping(0x1000000).
+		Build("Emu")
+	pwc := MakeBuilder().
+		WithEngine(engine).
+		WithLowModule(emu.topPort).
+		Build("PWC")
+
+	conn := sim.NewDirectConnection("Conn", engine, 1*sim.GHz)
+	conn.PlugIn(top.port, 4)
+	conn.PlugIn(pwc.topPort, 4)
+	conn.PlugIn(pwc.bottomPort, 4)
+	conn.PlugIn(emu.topPort, 4)
+
+	for _, vAddr := range []uint64{0x11064, 0x110c8} {
+		top.send(vm.TranslationReqBuilder{}.
+			WithDst(pwc.topPort).
+			WithPID(1).
+			WithVAddr(vAddr).
+			Build())
+	}
+	if err := engine.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	rsps := top.translationRsps()
+	if len(rsps) != 2 {
+		t.Fatalf("got %d responses, want 2", len(rsps))
+	}
+
+	for _, rsp := range rsps {
+		if rsp.Page.VAddr != 0x11000 || rsp.Page.PAddr != 0x1000000 {
+			t.Errorf("page = (0x%x, 0x%x), want (0x11000, 0x1000000)",
+				rsp.Page.VAddr, rsp.Page.PAddr)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package pwcache
+
+import (
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+type emulatorMapping struct {
+	pid                vm.PID
+	vAddr, pAddr, size uint64
+}
+
+// An EmulatorBuilder can build PageTableEmulators
+type EmulatorBuilder struct {
+	engine         sim.Engine
+	freq           sim.Freq
+	log2PageSize   uint64
+	numReqPerCycle int
+	pageTable      vm.PageTable
+	onDemand       bool
+	pAddrBase      uint64
+	mappings       []emulatorMapping
+}
+
+// MakeEmulatorBuilder returns an EmulatorBuilder
+func MakeEmulatorBuilder() EmulatorBuilder {
+	return EmulatorBuilder{
+		freq:           1 * sim.GHz,
+		log2PageSize:   12,
+		numReqPerCycle: 4,
+		pAddrBase:      0x100000000,
+	}
+}
+
+// WithEngine sets the engine that the emulator uses
+func (b EmulatorBuilder) WithEngine(engine sim.Engine) EmulatorBuilder {
+	b.engine = engine
+	return b
+}
+
+// WithFreq sets the freq the emulator uses
+func (b EmulatorBuilder) WithFreq(freq sim.Freq) EmulatorBuilder {
+	b.freq = freq
+	return b
+}
+
+// WithLog2PageSize sets the log2 of the page size
+func (b EmulatorBuilder) WithLog2PageSize(n uint64) EmulatorBuilder {
+	b.log2PageSize = n
+	return b
+}
+
+// WithNumReqPerCycle sets the number of requests that the emulator can accept
+// and the number of responses it can send per cycle
+func (b EmulatorBuilder) WithNumReqPerCycle(n int) EmulatorBuilder {
+	b.numReqPerCycle = n
+	return b
+}
+
+// WithPageTable sets the page table to walk. By default, the emulator creates
+// an empty one.
+func (b EmulatorBuilder) WithPageTable(pageTable vm.PageTable) EmulatorBuilder {
+	b.pageTable = pageTable
+	return b
+}
+
+// WithOnDemandMapping makes the emulator map unknown pages to fresh physical
+// pages instead of panicking.
+func (b EmulatorBuilder) WithOnDemandMapping(pAddrBase uint64) EmulatorBuilder {
+	b.onDemand = true
+	b.pAddrBase = pAddrBase
+	return b
+}
+
+// WithMapping maps the page that contains vAddr to the page that contains
+// pAddr when the emulator is built.
+func (b EmulatorBuilder) WithMapping(pid vm.PID, vAddr, pAddr uint64) EmulatorBuilder {
+	return b.WithMappedRange(pid, vAddr, pAddr, 1)
+}
+
+// WithMappedRange maps size bytes starting at vAddr to contiguous physical
+// pages starting at pAddr when the emulator is built.
+func (b EmulatorBuilder) WithMappedRange(
+	pid vm.PID,
+	vAddr, pAddr, size uint64,
+) EmulatorBuilder {
+	mappings := make([]emulatorMapping, len(b.mappings), len(b.mappings)+1)
+	copy(mappings, b.mappings)
+	b.mappings = append(mappings, emulatorMapping{pid, vAddr, pAddr, size})
+	return b
+}
+
+// Build creates a new PageTableEmulator
+func (b EmulatorBuilder) Build(name string) *PageTableEmulator {
+	e := &PageTableEmulator{}
+	e.TickingComponent = sim.NewTickingComponent(name, b.engine, b.freq, e)
+
+	e.log2PageSize = b.log2PageSize
+	e.numReqPerCycle = b.numReqPerCycle
+	e.onDemand = b.onDemand
+	e.nextPAddr = b.pAddrBase
+	e.pageTable = b.pageTable
+	if e.pageTable == nil {
+		e.pageTable = vm.NewPageTable(b.log2PageSize)
+	}
+
+	for _, m := range b.mappings {
+		e.MapRange(m.pid, m.vAddr, m.pAddr, m.size)
+	}
+
+	e.topPort = sim.NewLimitNumMsgPort(e, b.numReqPerCycle, name+".TopPort")
+	e.AddPort("Top", e.topPort)
+
+	return e
+}
@@ -2,10 +2,14 @@ module github.com/Sam-Yang6/pwcache
 
 go 1.24.3
 
-require github.com/sarchlab/akita/v3 v3.1.0
+require (
+	github.com/sarchlab/akita/v3 v3.1.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/go-sql-driver/mysql v1.7.1 // indirect
+	github.com/kr/text v0.2.0 // indirect
 	github.com/mattn/go-sqlite3 v1.14.16 // indirect
 	github.com/rs/xid v1.5.0 // indirect
 	github.com/tebeka/atexit v0.3.0 // indirect
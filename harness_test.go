@@ -0,0 +1,217 @@
+package pwcache
+
+import (
+	"testing"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+// testAgent is a component that sends scripted messages through its port and
+// records everything that it receives. It stands in for the L2 TLB on the top
+// port and for the driver on the control port.
+type testAgent struct {
+	*sim.TickingComponent
+
+	port     sim.Port
+	toSend   []sim.Msg
+	received []sim.Msg
+}
+
+func newTestAgent(name string, engine sim.Engine) *testAgent {
+	a := &testAgent{}
+	a.TickingComponent = sim.NewTickingComponent(name, engine, 1*sim.GHz, a)
+	a.port = sim.NewLimitNumMsgPort(a, 64, name+".Port")
+	a.AddPort("Port", a.port)
+	return a
+}
+
+func (a *testAgent) Tick(now sim.VTimeInSec) bool {
+	madeProgress := false
+
+	for a.port.Peek() != nil {
+		a.received = append(a.received, a.port.Retrieve(now))
+		madeProgress = true
+	}
+
+	for len(a.toSend) > 0 {
+		msg := a.toSend[0]
+		msg.Meta().SendTime = now
+		if a.port.Send(msg) != nil {
+			break
+		}
+
+		a.toSend = a.toSend[1:]
+		madeProgress = true
+	}
+
+	return madeProgress
+}
+
+// send queues a message to be sent as soon as the port allows.
+func (a *testAgent) send(msg sim.Msg) {
+	msg.Meta().Src = a.port
+	a.toSend = append(a.toSend, msg)
+	a.TickLater(a.Engine.CurrentTime())
+}
+
+// translationRsps returns the translation responses received so far.
+func (a *testAgent) translationRsps() []*vm.TranslationRsp {
+	var rsps []*vm.TranslationRsp
+	for _, msg := range a.received {
+		if rsp, ok := msg.(*vm.TranslationRsp); ok {
+			rsps = append(rsps, rsp)
+		}
+	}
+
+	return rsps
+}
+
+// scriptedLowModule answers every walk request after the number of cycles in
+// its Lantency field with a page whose physical address is derived from the
+// virtual address.
+type scriptedLowModule struct {
+	*sim.TickingComponent
+
+	port     sim.Port
+	received []*TranslationReqpwc
+	pending  []scriptedWalk
+}
+
+type scriptedWalk struct {
+	req     *TranslationReqpwc
+	readyAt sim.VTimeInSec
+}
+
+func newScriptedLowModule(name string, engine sim.Engine) *scriptedLowModule {
+	m := &scriptedLowModule{}
+	m.TickingComponent = sim.NewTickingComponent(name, engine, 1*sim.GHz, m)
+	m.port = sim.NewLimitNumMsgPort(m, 64, name+".Port")
+	m.AddPort("Port", m.port)
+	return m
+}
+
+func (m *scriptedLowModule) Tick(now sim.VTimeInSec) bool {
+	madeProgress := false
+
+	for m.port.Peek() != nil {
+		req := m.port.Retrieve(now).(*TranslationReqpwc)
+		m.received = append(m.received, req)
+		m.pending = append(m.pending, scriptedWalk{
+			req:     req,
+			readyAt: m.Freq.NCyclesLater(req.Lantency, now),
+		})
+		madeProgress = true
+	}
+
+	for len(m.pending) > 0 && m.pending[0].readyAt <= now {
+		req := m.pending[0].req
+		rsp := vm.TranslationRspBuilder{}.
+			WithSendTime(now).
+			WithSrc(m.port).
+			WithDst(req.Src).
+			WithRspTo(req.ID).
+			WithPage(scriptedPage(req.PID, req.VAddr)).
+			Build()
+		if m.port.Send(rsp) != nil {
+			break
+		}
+
+		m.pending = m.pending[1:]
+		madeProgress = true
+	}
+
+	return madeProgress || len(m.pending) > 0
+}
+
+// scriptedPage returns the page that holds vAddr. Like a page table, it
+// reports the page-aligned address rather than the one requested.
+func scriptedPage(pid vm.PID, vAddr uint64) vm.Page {
+	vAddr &^= 4096 - 1
+	return vm.Page{
+		PID:      pid,
+		VAddr:    vAddr,
+		PAddr:    vAddr + 0x100000000,
+		PageSize: 4096,
+		Valid:    true,
+	}
+}
+
+// pwcHarness wires a PWC to a top agent, a control agent, and a scripted low
+// module through a direct connection on a serial engine.
+type pwcHarness struct {
+	t      *testing.T
+	engine sim.Engine
+	pwc    *PWC
+	top    *testAgent
+	ctrl   *testAgent
+	low    *scriptedLowModule
+}
+
+func newPWCHarness(t *testing.T, b Builder) *pwcHarness {
+	h := &pwcHarness{t: t}
+	h.engine = sim.NewSerialEngine()
+	h.top = newTestAgent("Top", h.engine)
+	h.ctrl = newTestAgent("Ctrl", h.engine)
+	h.low = newScriptedLowModule("Low", h.engine)
+	h.pwc = b.WithEngine(h.engine).WithLowModule(h.low.port).Build("PWC")
+
+	conn := sim.NewDirectConnection("Conn", h.engine, 1*sim.GHz)
+	conn.PlugIn(h.top.port, 64)
+	conn.PlugIn(h.ctrl.port, 4)
+	conn.PlugIn(h.low.port, 64)
+	for _, port := range h.pwc.topPorts {
+		conn.PlugIn(port, 64)
+	}
+	conn.PlugIn(h.pwc.bottomPort, 64)
+	conn.PlugIn(h.pwc.controlPort, 4)
+
+	return h
+}
+
+// translate queues a translation request from the top agent.
+func (h *pwcHarness) translate(pid vm.PID, vAddr uint64) *vm.TranslationReq {
+	req := vm.TranslationReqBuilder{}.
+		WithSrc(h.top.port).
+		WithDst(h.pwc.topPort).
+		WithPID(pid).
+		WithVAddr(vAddr).
+		Build()
+	h.top.send(req)
+	return req
+}
+
+// translateFrom queues a translation request of a device from the top agent.
+func (h *pwcHarness) translateFrom(
+	deviceID uint64,
+	pid vm.PID,
+	vAddr uint64,
+) *vm.TranslationReq {
+	req := h.translate(pid, vAddr)
+	req.DeviceID = deviceID
+	return req
+}
+
+// control queues a message from the control agent to the control port.
+func (h *pwcHarness) control(msg sim.Msg) {
+	msg.Meta().Dst = h.pwc.controlPort
+	h.ctrl.send(msg)
+}
+
+// run simulates until no event is left.
+func (h *pwcHarness) run() {
+	if err := h.engine.Run(); err != nil {
+		h.t.Fatal(err)
+	}
+}
+
+// walkLatencies returns the Lantency field of every request that reached the
+// low module, in arrival order.
+func (h *pwcHarness) walkLatencies() []int {
+	var latencies []int
+	for _, req := range h.low.received {
+		latencies = append(latencies, req.Lantency)
+	}
+
+	return latencies
+}
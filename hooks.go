@@ -0,0 +1,98 @@
+package pwcache
+
+import (
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+// Hook positions at which a PWC invokes the hooks that it accepts. The item
+// and the detail of the HookCtx are given for each position.
+var (
+	// HookPosLookup follows the lookup of a walk in the sets. The item is the
+	// *vm.TranslationReq and the detail a LookupDetail.
+	HookPosLookup = &sim.HookPos{Name: "PWC Lookup"}
+
+	// HookPosFill follows the insertion of an entry into a way. The item is
+	// the entry's vm.Page, with VAddr set to the prefix, and the detail a
+	// FillDetail.
+	HookPosFill = &sim.HookPos{Name: "PWC Fill"}
+
+	// HookPosEvict precedes the replacement of a valid entry by a fill. The
+	// item is the victim's vm.Page and the detail an EvictDetail.
+	HookPosEvict = &sim.HookPos{Name: "PWC Evict"}
+
+	// HookPosMSHRMerge follows the merge of a request into the MSHR entry of
+	// an ongoing walk. The item is the *vm.TranslationReq and the detail an
+	// MSHRMergeDetail.
+	HookPosMSHRMerge = &sim.HookPos{Name: "PWC MSHR Merge"}
+
+	// HookPosFlush follows a flush. The item is the *FlushReq and the detail
+	// a FlushDetail.
+	HookPosFlush = &sim.HookPos{Name: "PWC Flush"}
+
+	// HookPosRestart follows a restart. The item is the *RestartReq and the
+	// detail a RestartDetail.
+	HookPosRestart = &sim.HookPos{Name: "PWC Restart"}
+)
+
+// LookupDetail describes the outcome of a lookup.
+type LookupDetail struct {
+	PID      vm.PID
+	VAddr    uint64
+	HitLevel int
+}
+
+// FillDetail locates an inserted entry.
+type FillDetail struct {
+	SetID int
+	WayID int
+	Level int
+	Owner uint64
+}
+
+// EvictDetail locates a victim entry. Level and Owner are the victim's.
+type EvictDetail struct {
+	SetID int
+	WayID int
+	Level int
+	Owner uint64
+}
+
+// MSHRMergeDetail describes the walk that a request was merged into.
+// NumMerged counts the requests waiting for the walk, including this one.
+type MSHRMergeDetail struct {
+	PID       vm.PID
+	VAddr     uint64
+	NumMerged int
+}
+
+// FlushDetail describes a flush. NumDropped counts the requests waiting in
+// the MSHR that will not be answered and Invalidated the entries invalidated
+// on the paths of VAddrs.
+type FlushDetail struct {
+	PID         vm.PID
+	VAddrs      []uint64
+	NumDropped  int
+	Invalidated int
+}
+
+// RestartDetail tells how many requests waiting at the top ports and in the
+// device queues were discarded by a restart.
+type RestartDetail struct {
+	NumDrained int
+}
+
+// invokeHook invokes the hooks at pos, except during a warm-up and in the
+// shadows, which have no component.
+func (pwc *PWC) invokeHook(pos *sim.HookPos, item, detail interface{}) {
+	if pwc.TickingComponent == nil || pwc.NumHooks() == 0 || pwc.warmingUp {
+		return
+	}
+
+	pwc.InvokeHook(sim.HookCtx{
+		Domain: pwc,
+		Pos:    pos,
+		Item:   item,
+		Detail: detail,
+	})
+}
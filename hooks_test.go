@@ -0,0 +1,127 @@
+package pwcache
+
+import (
+	"testing"
+
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+type recordingHook struct {
+	ctxs []sim.HookCtx
+}
+
+func (h *recordingHook) Func(ctx sim.HookCtx) {
+	h.ctxs = append(h.ctxs, ctx)
+}
+
+func (h *recordingHook) at(pos *sim.HookPos) []sim.HookCtx {
+	var ctxs []sim.HookCtx
+	for _, ctx := range h.ctxs {
+		if ctx.Pos == pos {
+			ctxs = append(ctxs, ctx)
+		}
+	}
+
+	return ctxs
+}
+
+func TestHooksReportLookupsFillsAndMerges(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	hook := &recordingHook{}
+	h.pwc.AcceptHook(hook)
+
+	h.translate(1, baseVAddr)
+	h.translate(1, baseVAddr)
+	h.run()
+	h.translate(1, sameL2VAddr)
+	h.run()
+
+	lookups := hook.at(HookPosLookup)
+	if len(lookups) != 2 {
+		t.Fatalf("got %d lookups, want 2", len(lookups))
+	}
+
+	if d := lookups[1].Detail.(LookupDetail); d.HitLevel != LevelL2 ||
+		d.VAddr != sameL2VAddr {
+		t.Errorf("second lookup = %+v, want an L2 hit of 0x%x", d, sameL2VAddr)
+	}
+
+	merges := hook.at(HookPosMSHRMerge)
+	if len(merges) != 1 || merges[0].Detail.(MSHRMergeDetail).NumMerged != 2 {
+		t.Errorf("merges = %+v, want one with 2 requests", merges)
+	}
+
+	fills := hook.at(HookPosFill)
+	if len(fills) != len(cachedLevels) {
+		t.Errorf("got %d fills, want %d", len(fills), len(cachedLevels))
+	}
+
+	if len(hook.at(HookPosEvict)) != 0 {
+		t.Error("a fill into an empty set reported an eviction")
+	}
+}
+
+func TestHooksReportEvictions(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().WithNumWays(3))
+	hook := &recordingHook{}
+	h.pwc.AcceptHook(hook)
+
+	h.translate(1, baseVAddr)
+	h.run()
+	h.translate(1, otherL4VAddr)
+	h.run()
+
+	evictions := hook.at(HookPosEvict)
+	if len(evictions) != 3 {
+		t.Fatalf("got %d evictions, want 3", len(evictions))
+	}
+
+	for _, ctx := range evictions {
+		d := ctx.Detail.(EvictDetail)
+		if d.WayID < 0 || d.WayID >= 3 || d.Level == LevelNone {
+			t.Errorf("eviction detail = %+v", d)
+		}
+	}
+}
+
+func TestHooksReportFlushAndRestart(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	hook := &recordingHook{}
+	h.pwc.AcceptHook(hook)
+
+	h.translate(1, baseVAddr)
+	h.run()
+	h.control(FlushReqBuilder{}.
+		WithPID(1).
+		WithVAddrs([]uint64{baseVAddr}).
+		Build())
+	h.run()
+	h.control(RestartReqBuilder{}.Build())
+	h.run()
+
+	flushes := hook.at(HookPosFlush)
+	if len(flushes) != 1 {
+		t.Fatalf("got %d flushes, want 1", len(flushes))
+	}
+
+	if d := flushes[0].Detail.(FlushDetail); d.Invalidated != 3 ||
+		d.NumDropped != 0 {
+		t.Errorf("flush detail = %+v, want 3 invalidated entries", d)
+	}
+
+	if len(hook.at(HookPosRestart)) != 1 {
+		t.Errorf("got %d restarts, want 1", len(hook.at(HookPosRestart)))
+	}
+}
+
+func TestWarmUpInvokesNoHook(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	hook := &recordingHook{}
+	h.pwc.AcceptHook(hook)
+
+	h.pwc.WarmUp([]Access{{PID: 1, VAddr: baseVAddr}})
+
+	if len(hook.ctxs) != 0 {
+		t.Errorf("warm-up invoked %d hooks", len(hook.ctxs))
+	}
+}
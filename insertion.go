@@ -0,0 +1,227 @@
+package pwcache
+
+import (
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+// InsertionPolicy selects which levels of a completed walk parseBottom
+// inserts into the PWC.
+type InsertionPolicy int
+
+// Insertion policies supported by the PWC.
+const (
+	// InsertAll inserts every level. Levels that are already cached are
+	// refreshed in place instead of being duplicated.
+	InsertAll InsertionPolicy = iota
+
+	// InsertMissing inserts only the levels that are not cached and leaves
+	// the replacement state of the cached ones untouched.
+	InsertMissing
+
+	// InsertLowest inserts only the L2 prefix.
+	InsertLowest
+
+	// InsertBypassLowReuse inserts a missing prefix only if it was walked
+	// recently, so that prefixes used by a single walk do not evict others.
+	InsertBypassLowReuse
+)
+
+// fillWalk inserts the entries of every level discovered by the walk that
+// translated page, in the sets and in the shadows.
+func (pwc *PWC) fillWalk(page vm.Page, owner uint64) {
+	for _, s := range pwc.shadows {
+		s.fillWalk(page, owner)
+	}
+
+	for _, level := range fillLevels {
+		pwc.fill(page, level, owner)
+	}
+}
+
+// fill inserts the prefix of page at the given level into its set on behalf
+// of a device, following the insertion policy. The fill is also dropped if
+// the way partition or the device way quota protects every candidate victim.
+func (pwc *PWC) fill(page vm.Page, level int, owner uint64) {
+	entry := page
+	entry.VAddr = pwc.prefix(page.VAddr, level)
+
+	setID := pwc.vAddrToSetID(entry.VAddr, level)
+	set := pwc.Sets[setID]
+
+	wayID, cached, found := set.Lookup(entry.PID, entry.VAddr, level)
+	if found && cached.Valid {
+		pwc.stats.FillsPresent[level]++
+		if pwc.insertion == InsertAll {
+			set.Update(wayID, entry, level)
+			set.Visit(wayID)
+			pwc.insertShadow(entry.PID, entry.VAddr, level)
+		}
+
+		return
+	}
+
+	if !pwc.shouldInsert(entry, level) {
+		pwc.stats.FillsBypassed[level]++
+		return
+	}
+
+	// A way that still holds the invalidated entry of the prefix is refilled
+	// in place, so that no two ways of the set share a key. The fill is
+	// bypassed if the filters protect that way.
+	if found {
+		if !allows(pwc.victimFilters(set, level, owner), wayID) {
+			pwc.stats.FillsBypassed[level]++
+			return
+		}
+
+		pwc.insertAt(setID, wayID, entry, level, owner)
+		return
+	}
+
+	wayID, ok := pwc.evict(set, level, owner)
+	if !ok {
+		pwc.stats.FillsBypassed[level]++
+		return
+	}
+
+	if victimLevel := set.Level(wayID); victimLevel != LevelNone &&
+		set.Page(wayID).Valid {
+		pwc.invokeHook(HookPosEvict, set.Page(wayID), EvictDetail{
+			SetID: setID,
+			WayID: wayID,
+			Level: victimLevel,
+			Owner: set.Owner(wayID),
+		})
+	}
+
+	pwc.insertAt(setID, wayID, entry, level, owner)
+}
+
+// evict selects the way that a fill replaces. It fails only when every
+// candidate way is protected by a reservation or a quota.
+func (pwc *PWC) evict(set Set, level int, owner uint64) (wayID int, ok bool) {
+	filters := pwc.victimFilters(set, level, owner)
+	canEvict := func(wayID int) bool { return allows(filters, wayID) }
+
+	switch pwc.replacement {
+	case ReplacementOPT:
+		return pwc.evictOPT(set, canEvict)
+	case ReplacementCostAware:
+		return pwc.evictCostAware(set, canEvict)
+	}
+
+	if len(filters) == 0 {
+		wayID, ok = set.Evict()
+		if !ok {
+			panic("failed to evict")
+		}
+
+		return wayID, ok
+	}
+
+	return set.EvictIf(canEvict)
+}
+
+// victimFilters returns the predicates of the way partition and the device
+// way quota that a way of set must pass for a fill of the level on behalf of
+// the device to replace it.
+func (pwc *PWC) victimFilters(
+	set Set,
+	level int,
+	owner uint64,
+) []func(wayID int) bool {
+	var filters []func(wayID int) bool
+	if pwc.partition.mode != PartitionNone {
+		filters = append(filters, pwc.partition.victimFilter(set, level))
+	}
+
+	if pwc.sharing == SharingWayQuota {
+		filters = append(filters, pwc.deviceQuotaFilter(set, owner))
+	}
+
+	return filters
+}
+
+// allows reports whether the way passes every filter.
+func allows(filters []func(wayID int) bool, wayID int) bool {
+	for _, f := range filters {
+		if !f(wayID) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (pwc *PWC) insertAt(
+	setID, wayID int,
+	entry vm.Page,
+	level int,
+	owner uint64,
+) {
+	set := pwc.Sets[setID]
+	set.Update(wayID, entry, level)
+	set.SetOwner(wayID, owner)
+	pwc.placeFill(set, setID, wayID)
+	pwc.tryPin(set, wayID)
+	pwc.stats.Fills[level]++
+	pwc.insertShadow(entry.PID, entry.VAddr, level)
+
+	pwc.invokeHook(HookPosFill, entry, FillDetail{
+		SetID: setID,
+		WayID: wayID,
+		Level: level,
+		Owner: owner,
+	})
+}
+
+func (pwc *PWC) shouldInsert(entry vm.Page, level int) bool {
+	switch pwc.insertion {
+	case InsertLowest:
+		return level == LevelL2
+	case InsertBypassLowReuse:
+		return pwc.reuseFilter.seenBefore(entry.PID, entry.VAddr, level)
+	default:
+		return true
+	}
+}
+
+type reuseKey struct {
+	pid    vm.PID
+	prefix uint64
+	level  int
+}
+
+// reuseFilter remembers the prefixes of recent fills that were not inserted.
+// A prefix that is filled again while still remembered has shown reuse.
+type reuseFilter struct {
+	capacity int
+	keys     map[reuseKey]bool
+	order    []reuseKey
+}
+
+func newReuseFilter(capacity int) *reuseFilter {
+	return &reuseFilter{
+		capacity: capacity,
+		keys:     make(map[reuseKey]bool),
+	}
+}
+
+// seenBefore reports whether the prefix was filled recently. A prefix seen
+// for the first time is remembered and reported as not seen.
+func (f *reuseFilter) seenBefore(pid vm.PID, prefix uint64, level int) bool {
+	key := reuseKey{pid: pid, prefix: prefix, level: level}
+	if f.keys[key] {
+		return true
+	}
+
+	if len(f.order) >= f.capacity {
+		delete(f.keys, f.order[0])
+		f.order = f.order[1:]
+	}
+
+	f.keys[key] = true
+	f.order = append(f.order, key)
+
+	return false
+}
@@ -0,0 +1,147 @@
+package pwcache
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+func TestInsertMissingLeavesCachedLevelsUntouched(t *testing.T) {
+	for _, tc := range []struct {
+		policy InsertionPolicy
+		victim int
+	}{
+		{InsertAll, LevelL2},
+		{InsertMissing, LevelL4},
+	} {
+		h := newPWCHarness(t, MakeBuilder().
+			WithNumWays(4).
+			WithInsertionPolicy(tc.policy))
+		h.translate(1, baseVAddr)
+		h.run()
+		h.translate(1, sameL3VAddr)
+		h.run()
+
+		set := h.pwc.Sets[0]
+		wayID, ok := h.pwc.evict(set, LevelL2, 0)
+		if !ok || set.Level(wayID) != tc.victim {
+			t.Errorf("%v: evicted a level %d entry, want level %d",
+				tc.policy, set.Level(wayID), tc.victim)
+		}
+	}
+}
+
+func TestFillsOfCachedLevelsCountAsPresent(t *testing.T) {
+	for _, policy := range []InsertionPolicy{InsertAll, InsertMissing} {
+		h := newPWCHarness(t, MakeBuilder().WithInsertionPolicy(policy))
+		h.translate(1, baseVAddr)
+		h.run()
+		h.translate(1, sameL3VAddr)
+		h.run()
+
+		stats := h.pwc.Stats()
+		if want := [numLevels]uint64{0, 1, 1, 0}; stats.FillsPresent != want {
+			t.Errorf("%v: present fills = %v, want %v",
+				policy, stats.FillsPresent, want)
+		}
+
+		if want := [numLevels]uint64{0, 1, 1, 2}; stats.Fills != want {
+			t.Errorf("%v: fills = %v, want %v", policy, stats.Fills, want)
+		}
+	}
+}
+
+func TestInsertLowestOnlyInsertsL2(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().WithInsertionPolicy(InsertLowest))
+	h.translate(1, baseVAddr)
+	h.run()
+
+	stats := h.pwc.Stats()
+	if want := [numLevels]uint64{0, 0, 0, 1}; stats.Fills != want {
+		t.Errorf("fills = %v, want %v", stats.Fills, want)
+	}
+
+	if want := [numLevels]uint64{0, 1, 1, 0}; stats.FillsBypassed != want {
+		t.Errorf("bypassed fills = %v, want %v", stats.FillsBypassed, want)
+	}
+}
+
+func TestInsertBypassLowReuseInsertsOnSecondWalk(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().
+		WithInsertionPolicy(InsertBypassLowReuse))
+	h.translate(1, baseVAddr)
+	h.run()
+	h.translate(1, baseVAddr)
+	h.run()
+	h.translate(1, sameL2VAddr)
+	h.run()
+
+	if got := h.walkLatencies(); !reflect.DeepEqual(got, []int{400, 400, 100}) {
+		t.Errorf("walk latencies = %v, want [400 400 100]", got)
+	}
+
+	stats := h.pwc.Stats()
+	for _, level := range cachedLevels {
+		if stats.FillsBypassed[level] != 1 || stats.Fills[level] != 1 {
+			t.Errorf("level %d: %d bypassed and %d fills, want 1 and 1",
+				level, stats.FillsBypassed[level], stats.Fills[level])
+		}
+	}
+}
+
+func TestFillsOfAddressZeroDoNotAliasAcrossLevels(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	h.translate(1, 0)
+	h.run()
+	h.translate(1, 0x1000)
+	h.run()
+
+	if got := h.walkLatencies(); !reflect.DeepEqual(got, []int{400, 100}) {
+		t.Errorf("walk latencies = %v, want [400 100]", got)
+	}
+
+	if got := h.pwc.Stats().Fills; got != [numLevels]uint64{0, 1, 1, 1} {
+		t.Errorf("fills = %v, want one per level", got)
+	}
+}
+
+func TestRefillOfInvalidatedEntryFollowsInsertionPolicy(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().WithInsertionPolicy(InsertLowest))
+	set := h.pwc.Sets[0]
+	wayID := fillSet(set, 1, 0, LevelL4)
+	set.Update(wayID, vm.Page{PID: 1}, LevelL4)
+
+	h.pwc.fill(scriptedPage(1, baseVAddr), LevelL4, 0)
+
+	if set.Page(wayID).Valid {
+		t.Error("InsertLowest refilled an invalidated L4 entry")
+	}
+
+	if got := h.pwc.Stats().FillsBypassed[LevelL4]; got != 1 {
+		t.Errorf("bypassed L4 fills = %d, want 1", got)
+	}
+}
+
+func TestRefillOfInvalidatedEntryRespectsWayQuota(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().
+		WithNumWays(4).
+		WithSharingPolicy(SharingWayQuota).
+		WithDeviceWayQuota(1))
+	set := h.pwc.Sets[0]
+	wayID := fillSet(set, 1, 0, LevelL4)
+	set.Update(wayID, vm.Page{PID: 1}, LevelL4)
+	set.SetOwner(wayID, 2)
+	owned := fillSet(set, 1, 0x40000000, LevelL3)
+	set.SetOwner(owned, 1)
+
+	h.pwc.fill(scriptedPage(1, baseVAddr), LevelL4, 1)
+
+	if set.Page(wayID).Valid || set.Owner(wayID) != 2 {
+		t.Error("device 1 took a way of device 2 beyond its quota")
+	}
+
+	if got := h.pwc.Stats().FillsBypassed[LevelL4]; got != 1 {
+		t.Errorf("bypassed L4 fills = %d, want 1", got)
+	}
+}
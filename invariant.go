@@ -0,0 +1,127 @@
+package pwcache
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+// An InvariantViolation describes an internal invariant of a PWC found broken
+// at the end of a tick.
+type InvariantViolation struct {
+	Component string
+	Cycle     uint64
+	Time      sim.VTimeInSec
+	Message   string
+}
+
+func (v InvariantViolation) Error() string {
+	return fmt.Sprintf("%s, cycle %d: %s", v.Component, v.Cycle, v.Message)
+}
+
+// A ViolationHandler is called for every invariant violation found by the
+// invariant checker.
+type ViolationHandler func(v InvariantViolation)
+
+// PanicOnViolation is a ViolationHandler that stops the simulation.
+func PanicOnViolation(v InvariantViolation) {
+	log.Panic(v.Error())
+}
+
+// checkInvariants reports every broken invariant of the PWC state.
+func (pwc *PWC) checkInvariants(now sim.VTimeInSec) {
+	var msgs []string
+
+	for setID, set := range pwc.Sets {
+		impl, ok := set.(*setImpl)
+		if !ok {
+			continue
+		}
+
+		for _, msg := range impl.checkInvariants() {
+			msgs = append(msgs, fmt.Sprintf("set %d: %s", setID, msg))
+		}
+	}
+
+	for i := 0; ; i++ {
+		pwe, err := pwc.pwqueue.Index(i)
+		if err != nil {
+			break
+		}
+
+		if pwc.mshr.Query(pwe.Req.PID, pwe.Req.VAddr) == nil {
+			msgs = append(msgs, fmt.Sprintf(
+				"pwqueue entry (PID %d, VAddr 0x%x) has no MSHR entry",
+				pwe.Req.PID, pwe.Req.VAddr))
+		}
+	}
+
+	for _, e := range pwc.mshr.AllEntries() {
+		if e == pwc.respondingMSHREntry {
+			msgs = append(msgs, fmt.Sprintf(
+				"responding entry (PID %d, VAddr 0x%x) is still in the MSHR",
+				e.pid, e.vAddr))
+		}
+	}
+
+	for _, msg := range msgs {
+		pwc.onViolation(InvariantViolation{
+			Component: pwc.Name(),
+			Cycle:     pwc.Freq.Cycle(now),
+			Time:      now,
+			Message:   msg,
+		})
+	}
+}
+
+// checkInvariants returns a description of every inconsistency among the
+// blocks, the key map, and the visit list.
+func (s *setImpl) checkInvariants() []string {
+	var msgs []string
+
+	owners := make(map[string]int)
+	for _, b := range s.blocks {
+		if b.level == LevelNone {
+			continue
+		}
+
+		key := s.keyString(b.page.PID, b.page.VAddr, b.level)
+		if other, found := owners[key]; found {
+			msgs = append(msgs, fmt.Sprintf(
+				"ways %d and %d hold the same entry", other, b.wayID))
+		}
+		owners[key] = b.wayID
+
+		if wayID, found := s.vAddrWayIDMap[key]; !found || wayID != b.wayID {
+			msgs = append(msgs, fmt.Sprintf(
+				"way %d is not indexed by its key", b.wayID))
+		}
+	}
+
+	if len(s.visitList) != len(s.blocks) {
+		msgs = append(msgs, fmt.Sprintf(
+			"visit list holds %d blocks, want %d",
+			len(s.visitList), len(s.blocks)))
+	}
+
+	seen := make(map[int]bool)
+	for i, b := range s.visitList {
+		if seen[b.wayID] {
+			msgs = append(msgs, fmt.Sprintf(
+				"way %d appears twice in the visit list", b.wayID))
+		}
+		seen[b.wayID] = true
+
+		if s.blocks[b.wayID] != b {
+			msgs = append(msgs, fmt.Sprintf(
+				"visit list holds a stale block for way %d", b.wayID))
+		}
+
+		if i > 0 && s.visitList[i-1].lastVisit > b.lastVisit {
+			msgs = append(msgs, "visit list is not ordered by last visit")
+		}
+	}
+
+	return msgs
+}
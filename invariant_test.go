@@ -0,0 +1,67 @@
+package pwcache
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Sam-Yang6/pwcache/pwqueue"
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+func collectViolations(vs *[]InvariantViolation) ViolationHandler {
+	return func(v InvariantViolation) {
+		*vs = append(*vs, v)
+	}
+}
+
+func TestInvariantsHoldThroughWalksAndFlush(t *testing.T) {
+	var violations []InvariantViolation
+	h := newPWCHarness(t, MakeBuilder().
+		WithNumWays(4).
+		WithInvariantCheck(collectViolations(&violations)))
+
+	for i := uint64(0); i < 8; i++ {
+		h.translate(1, baseVAddr+i<<21)
+		h.translate(1, baseVAddr+i<<21)
+	}
+	h.run()
+
+	h.control(FlushReqBuilder{}.WithPID(1).WithVAddrs([]uint64{baseVAddr}).Build())
+	h.control(RestartReqBuilder{}.Build())
+	h.run()
+
+	for _, v := range violations {
+		t.Error(v)
+	}
+}
+
+func TestInvariantCheckReportsOrphanedPWQueueEntry(t *testing.T) {
+	var violations []InvariantViolation
+	h := newPWCHarness(t, MakeBuilder().
+		WithInvariantCheck(collectViolations(&violations)))
+
+	req := &vm.TranslationReq{PID: 3, VAddr: 0x4000}
+	h.pwc.pwqueue.Enqueue(pwqueue.Newpwqueueentry(req, 0))
+	h.pwc.checkInvariants(0)
+
+	if len(violations) != 1 ||
+		!strings.Contains(violations[0].Message, "no MSHR entry") {
+		t.Fatalf("violations = %v, want one orphaned pwqueue entry", violations)
+	}
+
+	if violations[0].Component != "PWC" {
+		t.Errorf("component = %q, want PWC", violations[0].Component)
+	}
+}
+
+func TestSetInvariantsReportDuplicatedEntries(t *testing.T) {
+	set := NewSet(2).(*setImpl)
+	page := vm.Page{PID: 1, VAddr: 0x200000, Valid: true}
+	set.Update(0, page, LevelL2)
+	set.Update(1, page, LevelL2)
+
+	msgs := set.checkInvariants()
+	if !strings.Contains(strings.Join(msgs, "\n"), "same entry") {
+		t.Errorf("messages = %v, want a duplicated entry", msgs)
+	}
+}
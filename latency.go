@@ -0,0 +1,126 @@
+package pwcache
+
+import (
+	"math/bits"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+// A Phase is a part of the time between the arrival of a translation request
+// at a top port and the departure of its response.
+type Phase int
+
+// Phases of a translation request. The boundaries are those of the walk that
+// serves the request, so a request merged into an ongoing walk only spends
+// the remaining part of the walk in each phase.
+const (
+	// PhaseQueue is the wait at the top port, in the MSHR, and in the
+	// pwqueue until a walker takes the walk.
+	PhaseQueue Phase = iota
+
+	// PhaseLookup is the lookup of the sets.
+	PhaseLookup
+
+	// PhaseLowModule is the walk in the low module, until its response
+	// arrives at the bottom port.
+	PhaseLowModule
+
+	// PhaseRespond is the wait for respondingMSHREntry to be free and for
+	// the responses of the requests merged before this one.
+	PhaseRespond
+
+	numPhases
+)
+
+var phaseNames = [numPhases]string{"queue", "lookup", "low-module", "respond"}
+
+// String returns the name of the phase.
+func (p Phase) String() string {
+	return phaseNames[p]
+}
+
+// A Histogram counts samples in cycles in buckets of powers of 2. Bucket 0
+// holds the samples of 0 cycles and bucket i the samples in [2^(i-1), 2^i).
+type Histogram struct {
+	Buckets [65]uint64
+	Count   uint64
+	Sum     uint64
+	Max     uint64
+}
+
+// Add counts a sample.
+func (h *Histogram) Add(cycles uint64) {
+	h.Buckets[bits.Len64(cycles)]++
+	h.Count++
+	h.Sum += cycles
+	h.Max = max(h.Max, cycles)
+}
+
+// Mean returns the average of the samples.
+func (h Histogram) Mean() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+
+	return float64(h.Sum) / float64(h.Count)
+}
+
+// Percentile returns an upper bound of the value below which a fraction q of
+// the samples fall, which is the top of the bucket that holds it.
+func (h Histogram) Percentile(q float64) uint64 {
+	if h.Count == 0 {
+		return 0
+	}
+
+	rank := uint64(q * float64(h.Count))
+	var seen uint64
+	for i, n := range h.Buckets {
+		seen += n
+		if seen > rank || seen == h.Count {
+			if i == 0 {
+				return 0
+			}
+
+			return min(h.Max, uint64(1)<<i-1)
+		}
+	}
+
+	return h.Max
+}
+
+// Latencies holds a histogram of the cycles spent in each phase by the
+// translation requests answered so far, and one of their total latency.
+type Latencies struct {
+	Phases [numPhases]Histogram
+	Total  Histogram
+}
+
+// Latencies returns a copy of the latency histograms.
+func (pwc *PWC) Latencies() Latencies {
+	return pwc.latencies
+}
+
+// recordLatency splits the time that req spent in the PWC into phases at the
+// boundaries of the walk of e, clipped to the arrival and the departure of
+// req.
+func (pwc *PWC) recordLatency(
+	now sim.VTimeInSec,
+	req *vm.TranslationReq,
+	e *mshrEntry,
+) {
+	arrival := req.RecvTime
+	bounds := [numPhases + 1]sim.VTimeInSec{
+		arrival, e.lookupStart, e.lookupEnd, e.walkDone, now,
+	}
+
+	start := pwc.Freq.Cycle(arrival)
+	for p := Phase(0); p < numPhases; p++ {
+		end := pwc.Freq.Cycle(min(max(bounds[p+1], arrival), now))
+		end = max(end, start)
+		pwc.latencies.Phases[p].Add(end - start)
+		start = end
+	}
+
+	pwc.latencies.Total.Add(pwc.Freq.Cycle(now) - pwc.Freq.Cycle(arrival))
+}
@@ -0,0 +1,71 @@
+package pwcache
+
+import "testing"
+
+func TestHistogramBuckets(t *testing.T) {
+	var h Histogram
+	for _, c := range []uint64{0, 1, 2, 3, 4, 100} {
+		h.Add(c)
+	}
+
+	if h.Buckets[0] != 1 || h.Buckets[1] != 1 || h.Buckets[2] != 2 ||
+		h.Buckets[3] != 1 || h.Buckets[7] != 1 {
+		t.Errorf("buckets = %v", h.Buckets[:8])
+	}
+
+	if h.Count != 6 || h.Sum != 110 || h.Max != 100 {
+		t.Errorf("count %d, sum %d, max %d", h.Count, h.Sum, h.Max)
+	}
+
+	if p := h.Percentile(0.5); p != 3 {
+		t.Errorf("median bound = %d, want 3", p)
+	}
+
+	if p := h.Percentile(1); p != 100 {
+		t.Errorf("maximum bound = %d, want 100", p)
+	}
+}
+
+func TestLatencyPhasesAddUpToTotal(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	h.translate(1, baseVAddr)
+	h.translate(1, baseVAddr)
+	h.run()
+
+	l := h.pwc.Latencies()
+	if l.Total.Count != 2 {
+		t.Fatalf("total has %d samples, want 2", l.Total.Count)
+	}
+
+	var sum uint64
+	for p := Phase(0); p < numPhases; p++ {
+		if l.Phases[p].Count != 2 {
+			t.Errorf("phase %s has %d samples, want 2", p, l.Phases[p].Count)
+		}
+
+		sum += l.Phases[p].Sum
+	}
+
+	if sum != l.Total.Sum {
+		t.Errorf("phases sum to %d cycles, total is %d", sum, l.Total.Sum)
+	}
+
+	if l.Phases[PhaseLookup].Max < 10 {
+		t.Errorf("lookup took at most %d cycles, want at least 10",
+			l.Phases[PhaseLookup].Max)
+	}
+
+	if l.Phases[PhaseLowModule].Max < 400 {
+		t.Errorf("walk took at most %d cycles, want at least 400",
+			l.Phases[PhaseLowModule].Max)
+	}
+
+	if l.Phases[PhaseRespond].Max == 0 {
+		t.Error("the merged request did not wait to respond")
+	}
+
+	h.pwc.ResetStats()
+	if h.pwc.Latencies().Total.Count != 0 {
+		t.Error("ResetStats kept the latency histograms")
+	}
+}
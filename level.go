@@ -0,0 +1,36 @@
+package pwcache
+
+// Page-table levels whose prefixes are cached by the PWC. The values are the
+// hit levels recorded in the pwqueue entries: a hit at LevelL2 skips three of
+// the four memory accesses of a walk, while LevelNone is a full walk.
+const (
+	LevelNone = 0
+	LevelL4   = 1
+	LevelL3   = 2
+	LevelL2   = 3
+)
+
+// numLevels is the size of arrays indexed by level, including LevelNone.
+const numLevels = 4
+
+// cachedLevels lists the levels from the deepest to the shallowest, which is
+// the order that PWClookup probes them.
+var cachedLevels = []int{LevelL2, LevelL3, LevelL4}
+
+// fillLevels lists the levels from the shallowest to the deepest, which is the
+// order that a walk discovers them and parseBottom inserts them.
+var fillLevels = []int{LevelL4, LevelL3, LevelL2}
+
+var levelNames = [numLevels]string{"miss", "l4", "l3", "l2"}
+
+// levelShift returns how many low bits of a virtual address are dropped to
+// form the prefix of the given level.
+func (pwc *PWC) levelShift(level int) uint64 {
+	return pwc.log2PageSize + 9*uint64(4-level)
+}
+
+// prefix returns the part of vAddr that indexes the entry of the given level.
+func (pwc *PWC) prefix(vAddr uint64, level int) uint64 {
+	shift := pwc.levelShift(level)
+	return vAddr >> shift << shift
+}
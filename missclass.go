@@ -0,0 +1,179 @@
+package pwcache
+
+import (
+	"container/list"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+// A MissClass tells why a lookup missed a level.
+type MissClass int
+
+// Classes of misses.
+const (
+	// MissCompulsory is the first reference to the prefix.
+	MissCompulsory MissClass = iota
+
+	// MissCapacity would also miss in a fully-associative LRU cache of the
+	// same number of entries.
+	MissCapacity
+
+	// MissConflict would hit in a fully-associative LRU cache of the same
+	// number of entries.
+	MissConflict
+
+	numMissClasses
+)
+
+var missClassNames = [numMissClasses]string{"compulsory", "capacity", "conflict"}
+
+// String returns the name of the class.
+func (c MissClass) String() string {
+	return missClassNames[c]
+}
+
+// MissCounts counts the misses of each class, indexed by level and class.
+type MissCounts [numLevels][numMissClasses]uint64
+
+// MissClassification holds the classified misses of all the processes and
+// of each one.
+type MissClassification struct {
+	Total  MissCounts
+	PerPID map[vm.PID]MissCounts
+}
+
+// MissClassification returns a copy of the classified misses. It is empty
+// unless the PWC was built with miss classification.
+func (pwc *PWC) MissClassification() MissClassification {
+	mc := MissClassification{PerPID: make(map[vm.PID]MissCounts)}
+	if pwc.missClassifier == nil {
+		return mc
+	}
+
+	mc.Total = pwc.missClassifier.total
+	for pid, counts := range pwc.missClassifier.perPID {
+		mc.PerPID[pid] = *counts
+	}
+
+	return mc
+}
+
+// missClassifier keeps a fully-associative LRU shadow of the sets, fed with
+// the same lookups and fills, and remembers every prefix ever referenced.
+type missClassifier struct {
+	capacity int
+	lru      *list.List
+	entries  map[reuseKey]*list.Element
+	seen     map[reuseKey]bool
+
+	total  MissCounts
+	perPID map[vm.PID]*MissCounts
+}
+
+func newMissClassifier(capacity int) *missClassifier {
+	return &missClassifier{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[reuseKey]*list.Element),
+		seen:     make(map[reuseKey]bool),
+		perPID:   make(map[vm.PID]*MissCounts),
+	}
+}
+
+// classify counts a miss of the sets at the key's level and references the
+// key in the shadow.
+func (c *missClassifier) classify(key reuseKey) {
+	class := MissCapacity
+	switch {
+	case !c.seen[key]:
+		class = MissCompulsory
+	case c.entries[key] != nil:
+		class = MissConflict
+	}
+
+	c.total[key.level][class]++
+	counts := c.perPID[key.pid]
+	if counts == nil {
+		counts = &MissCounts{}
+		c.perPID[key.pid] = counts
+	}
+	counts[key.level][class]++
+
+	c.touch(key)
+}
+
+// touch references the key, making it the most recently used if present.
+func (c *missClassifier) touch(key reuseKey) {
+	c.seen[key] = true
+	if e := c.entries[key]; e != nil {
+		c.lru.MoveToFront(e)
+	}
+}
+
+// insert adds the key to the shadow, evicting the least recently used one if
+// the shadow is full.
+func (c *missClassifier) insert(key reuseKey) {
+	c.seen[key] = true
+	if e := c.entries[key]; e != nil {
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	if c.lru.Len() >= c.capacity {
+		victim := c.lru.Back()
+		c.lru.Remove(victim)
+		delete(c.entries, victim.Value.(reuseKey))
+	}
+
+	c.entries[key] = c.lru.PushFront(key)
+}
+
+// remove drops the key from the shadow.
+func (c *missClassifier) remove(key reuseKey) {
+	if e := c.entries[key]; e != nil {
+		c.lru.Remove(e)
+		delete(c.entries, key)
+	}
+}
+
+// reset clears the counters and keeps the shadow.
+func (c *missClassifier) reset() {
+	c.total = MissCounts{}
+	c.perPID = make(map[vm.PID]*MissCounts)
+}
+
+// insertShadow mirrors the insertion of an entry into the sets.
+func (pwc *PWC) insertShadow(pid vm.PID, prefix uint64, level int) {
+	if pwc.missClassifier != nil {
+		pwc.missClassifier.insert(reuseKey{pid: pid, prefix: prefix, level: level})
+	}
+}
+
+// removeShadow mirrors the invalidation of an entry of the sets.
+func (pwc *PWC) removeShadow(pid vm.PID, prefix uint64, level int) {
+	if pwc.missClassifier != nil {
+		pwc.missClassifier.remove(reuseKey{pid: pid, prefix: prefix, level: level})
+	}
+}
+
+// classifyMisses classifies the misses of the levels that a lookup of vAddr
+// probed before hitting hitlevel, and references the hit entry.
+func (pwc *PWC) classifyMisses(pid vm.PID, vAddr uint64, hitlevel int) {
+	if pwc.missClassifier == nil {
+		return
+	}
+
+	for _, level := range cachedLevels {
+		key := reuseKey{
+			pid:    pid,
+			prefix: pwc.prefix(vAddr, level),
+			level:  level,
+		}
+		if level == hitlevel {
+			pwc.missClassifier.touch(key)
+			return
+		}
+
+		pwc.missClassifier.classify(key)
+	}
+}
@@ -0,0 +1,61 @@
+package pwcache
+
+import (
+	"testing"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+func TestMissClassifierClassifiesAgainstShadow(t *testing.T) {
+	c := newMissClassifier(2)
+	a := reuseKey{pid: 1, prefix: 0x1000, level: LevelL2}
+	b := reuseKey{pid: 1, prefix: 0x2000, level: LevelL2}
+	d := reuseKey{pid: 2, prefix: 0x3000, level: LevelL2}
+
+	c.classify(a)
+	c.insert(a)
+	c.classify(b)
+	c.insert(b)
+	c.classify(d)
+	c.insert(d) // evicts a from the shadow
+
+	c.classify(a)
+	c.classify(b)
+
+	want := [numMissClasses]uint64{3, 1, 1}
+	if c.total[LevelL2] != want {
+		t.Errorf("L2 misses = %v, want %v", c.total[LevelL2], want)
+	}
+
+	if got := c.perPID[2][LevelL2][MissCompulsory]; got != 1 {
+		t.Errorf("compulsory misses of PID 2 = %d, want 1", got)
+	}
+}
+
+func TestPWCClassifiesLookupMisses(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().WithMissClassification(true))
+	h.translate(1, baseVAddr)
+	h.run()
+	h.translate(1, sameL3VAddr)
+	h.translate(2, baseVAddr)
+	h.run()
+
+	mc := h.pwc.MissClassification()
+
+	var want MissCounts
+	want[LevelL4][MissCompulsory] = 2
+	want[LevelL3][MissCompulsory] = 2
+	want[LevelL2][MissCompulsory] = 3
+	if mc.Total != want {
+		t.Errorf("misses = %v, want %v", mc.Total, want)
+	}
+
+	if got := mc.PerPID[vm.PID(2)][LevelL4][MissCompulsory]; got != 1 {
+		t.Errorf("compulsory L4 misses of PID 2 = %d, want 1", got)
+	}
+
+	h.pwc.ResetStats()
+	if len(h.pwc.MissClassification().PerPID) != 0 {
+		t.Error("ResetStats kept the miss classification")
+	}
+}
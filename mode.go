@@ -0,0 +1,34 @@
+package pwcache
+
+// LookupMode selects whether PWClookup reports the hit level found in the
+// sets or a fixed one, for computing performance bounds.
+type LookupMode int
+
+// Lookup modes supported by the PWC.
+const (
+	// LookupNormal reports the level found in the sets.
+	LookupNormal LookupMode = iota
+
+	// LookupIdeal reports an L2 hit for every request, as a perfect PWC
+	// would.
+	LookupIdeal
+
+	// LookupDisabled reports a miss for every request, as if there were no
+	// PWC.
+	LookupDisabled
+)
+
+// applyLookupMode overrides the hit level found in the sets according to the
+// lookup mode. The sets are still looked up and filled so that the rest of
+// the pipeline behaves as in the normal mode, and the statistics keep
+// counting the level found in the sets.
+func (pwc *PWC) applyLookupMode(hitlevel int) int {
+	switch pwc.lookupMode {
+	case LookupIdeal:
+		return LevelL2
+	case LookupDisabled:
+		return LevelNone
+	default:
+		return hitlevel
+	}
+}
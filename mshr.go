@@ -4,14 +4,30 @@ import (
 	"log"
 
 	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
 )
 
 type mshrEntry struct {
 	pid         vm.PID
 	vAddr       uint64
+	deviceID    uint64
 	Requests    []*vm.TranslationReq
 	reqToBottom *TranslationReqpwc
 	page        vm.Page
+	hitlevel    int
+	walk        *walkTrace
+
+	// tracePos is the position in the Oracle of the request that started
+	// the walk.
+	tracePos int
+
+	// replay marks a walk restored from a snapshot after its lookup, which is
+	// issued again without a second lookup.
+	replay bool
+
+	lookupStart sim.VTimeInSec
+	lookupEnd   sim.VTimeInSec
+	walkDone    sim.VTimeInSec
 }
 
 // newMSHREntry returns a new MSHR entry object
@@ -0,0 +1,34 @@
+package pwcache
+
+import "testing"
+
+func TestMSHRAddQueryRemove(t *testing.T) {
+	m := newMSHR(2)
+	m.Add(1, 0x1000)
+	m.Add(1, 0x2000)
+
+	if !m.IsFull() {
+		t.Error("MSHR with 2 of 2 entries is not full")
+	}
+
+	if m.Query(1, 0x1000) == nil || m.Query(2, 0x1000) != nil {
+		t.Error("query does not match on both PID and address")
+	}
+
+	m.Remove(1, 0x1000)
+	if m.IsEntryPresent(1, 0x1000) || len(m.AllEntries()) != 1 {
+		t.Error("entry is still present after removal")
+	}
+}
+
+func TestMSHRAddPanicsOnDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("adding a duplicated entry did not panic")
+		}
+	}()
+
+	m := newMSHR(2)
+	m.Add(1, 0x1000)
+	m.Add(1, 0x1000)
+}
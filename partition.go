@@ -0,0 +1,119 @@
+package pwcache
+
+// PartitionMode selects how the ways of a set are shared among the page-table
+// levels.
+type PartitionMode int
+
+// Partition modes supported by the PWC.
+const (
+	// PartitionNone lets every level compete for every way under LRU.
+	PartitionNone PartitionMode = iota
+
+	// PartitionStatic reserves a fixed number of ways per level in each set.
+	PartitionStatic
+
+	// PartitionAdaptive periodically redistributes the reserved ways in
+	// proportion to the hits each level received.
+	PartitionAdaptive
+)
+
+// wayPartition decides which ways a fill may evict so that every level keeps
+// at least its reserved number of ways in a set.
+type wayPartition struct {
+	mode     PartitionMode
+	numWays  int
+	reserved [numLevels]int
+
+	budget    int
+	epoch     uint64
+	hits      [numLevels]uint64
+	numLookup uint64
+}
+
+func newWayPartition(
+	mode PartitionMode,
+	numWays int,
+	reserved [numLevels]int,
+	epoch uint64,
+) *wayPartition {
+	p := &wayPartition{
+		mode:     mode,
+		numWays:  numWays,
+		reserved: reserved,
+		epoch:    epoch,
+	}
+
+	for _, n := range reserved {
+		p.budget += n
+	}
+
+	if mode == PartitionAdaptive && p.budget == 0 {
+		p.budget = numWays / 2
+		p.redistribute()
+	}
+
+	return p
+}
+
+// recordLookup accounts a PWC lookup that hit the given level. LevelNone
+// stands for a miss.
+func (p *wayPartition) recordLookup(level int) {
+	if p.mode != PartitionAdaptive {
+		return
+	}
+
+	p.hits[level]++
+	p.numLookup++
+
+	if p.numLookup%p.epoch == 0 {
+		p.redistribute()
+	}
+}
+
+// redistribute splits the budget of reserved ways among the cached levels in
+// proportion to their hits, then ages the counters so that the partition
+// follows phase changes.
+func (p *wayPartition) redistribute() {
+	var total uint64
+	for _, level := range cachedLevels {
+		total += p.hits[level]
+	}
+
+	for _, level := range cachedLevels {
+		if total == 0 {
+			p.reserved[level] = p.budget / len(cachedLevels)
+			continue
+		}
+
+		p.reserved[level] = int(uint64(p.budget) * p.hits[level] / total)
+	}
+
+	for i := range p.hits {
+		p.hits[i] /= 2
+	}
+}
+
+// victimFilter returns a predicate that accepts the ways of set that a fill
+// of the given level may evict without taking another level below its
+// reservation.
+func (p *wayPartition) victimFilter(set Set, level int) func(wayID int) bool {
+	var occupancy [numLevels]int
+	for wayID := 0; wayID < p.numWays; wayID++ {
+		occupancy[set.Level(wayID)]++
+	}
+
+	return func(wayID int) bool {
+		victimLevel := set.Level(wayID)
+		if victimLevel == LevelNone || victimLevel == level {
+			return true
+		}
+
+		return occupancy[victimLevel] > p.reserved[victimLevel]
+	}
+}
+
+// ReservedWays returns the number of ways per set currently reserved for the
+// given page-table level.
+func (pwc *PWC) ReservedWays(level int) int {
+	return pwc.partition.reserved[level]
+}
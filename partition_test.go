@@ -0,0 +1,111 @@
+package pwcache
+
+import (
+	"testing"
+)
+
+func TestPartitionVictimFilterProtectsReservations(t *testing.T) {
+	set := NewSet(4)
+	l4 := fillSet(set, 1, 0, LevelL4)
+	l3 := fillSet(set, 1, 0, LevelL3)
+	l2 := fillSet(set, 1, 0, LevelL2)
+	p := newWayPartition(PartitionStatic, 4, [numLevels]int{0, 1, 1, 0}, 0)
+
+	for _, tc := range []struct {
+		level     int
+		evictable map[int]bool
+	}{
+		{LevelL2, map[int]bool{l4: false, l3: false, l2: true}},
+		{LevelL4, map[int]bool{l4: true, l3: false, l2: true}},
+	} {
+		canEvict := p.victimFilter(set, tc.level)
+		for wayID, want := range tc.evictable {
+			if got := canEvict(wayID); got != want {
+				t.Errorf("level %d fill may evict way %d = %v, want %v",
+					tc.level, wayID, got, want)
+			}
+		}
+
+		if !canEvict(3) {
+			t.Errorf("level %d fill may not take the empty way", tc.level)
+		}
+	}
+}
+
+func TestStaticPartitionBypassesFillsOfUnreservedLevels(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().
+		WithNumWays(2).
+		WithPartitionMode(PartitionStatic).
+		WithReservedWays(1, 1, 0))
+	h.translate(1, baseVAddr)
+	h.run()
+
+	stats := h.pwc.Stats()
+	if want := [numLevels]uint64{0, 1, 1, 0}; stats.Fills != want {
+		t.Errorf("fills = %v, want %v", stats.Fills, want)
+	}
+
+	if want := [numLevels]uint64{0, 0, 0, 1}; stats.FillsBypassed != want {
+		t.Errorf("bypassed fills = %v, want %v", stats.FillsBypassed, want)
+	}
+}
+
+func TestStaticPartitionKeepsReservedWays(t *testing.T) {
+	for _, tc := range []struct {
+		mode PartitionMode
+		want [numLevels]int
+	}{
+		{PartitionNone, [numLevels]int{0, 0, 1, 3}},
+		{PartitionStatic, [numLevels]int{0, 1, 1, 2}},
+	} {
+		h := newPWCHarness(t, MakeBuilder().
+			WithNumWays(4).
+			WithInsertionPolicy(InsertMissing).
+			WithPartitionMode(tc.mode).
+			WithReservedWays(1, 1, 0))
+		for i := uint64(0); i < 3; i++ {
+			h.translate(1, baseVAddr+i<<21)
+			h.run()
+		}
+
+		var got [numLevels]int
+		set := h.pwc.Sets[0]
+		for wayID := 0; wayID < 4; wayID++ {
+			got[set.Level(wayID)]++
+		}
+
+		if got != tc.want {
+			t.Errorf("mode %d: ways per level = %v, want %v", tc.mode, got,
+				tc.want)
+		}
+	}
+}
+
+func TestAdaptivePartitionFollowsHits(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().
+		WithNumWays(8).
+		WithPartitionMode(PartitionAdaptive).
+		WithPartitionEpoch(4))
+
+	for _, level := range cachedLevels {
+		if got := h.pwc.ReservedWays(level); got != 1 {
+			t.Errorf("level %d: %d reserved ways before an epoch, want 1",
+				level, got)
+		}
+	}
+
+	h.translate(1, baseVAddr)
+	h.run()
+	for i := 0; i < 3; i++ {
+		h.translate(1, sameL2VAddr)
+		h.run()
+	}
+
+	want := [numLevels]int{0, 0, 0, 4}
+	for _, level := range cachedLevels {
+		if got := h.pwc.ReservedWays(level); got != want[level] {
+			t.Errorf("level %d: %d reserved ways after an epoch, want %d",
+				level, got, want[level])
+		}
+	}
+}
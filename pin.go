@@ -0,0 +1,172 @@
+package pwcache
+
+import (
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+// pinRange is a virtual address range [start, end) of a process whose entries
+// must stay resident.
+type pinRange struct {
+	pid        vm.PID
+	start, end uint64
+}
+
+func (r pinRange) overlaps(pid vm.PID, start, end uint64) bool {
+	return r.pid == pid && r.start < end && start < r.end
+}
+
+// entryRange returns the virtual address range translated through the entry
+// held by the way.
+func (pwc *PWC) entryRange(set Set, wayID int) (start, end uint64) {
+	start = set.Page(wayID).VAddr
+	end = start + 1<<pwc.levelShift(set.Level(wayID))
+	return start, end
+}
+
+// without returns the parts of the range that fall outside [start, end) of the
+// process.
+func (r pinRange) without(pid vm.PID, start, end uint64) []pinRange {
+	if !r.overlaps(pid, start, end) {
+		return []pinRange{r}
+	}
+
+	var parts []pinRange
+	if r.start < start {
+		parts = append(parts, pinRange{pid: r.pid, start: r.start, end: start})
+	}
+
+	if end < r.end {
+		parts = append(parts, pinRange{pid: r.pid, start: end, end: r.end})
+	}
+
+	return parts
+}
+
+func (pwc *PWC) isInPinnedRange(set Set, wayID int) bool {
+	return pwc.isInRanges(pwc.pinnedRanges, set, wayID)
+}
+
+func (pwc *PWC) isInRanges(ranges []pinRange, set Set, wayID int) bool {
+	if set.Level(wayID) == LevelNone || !set.Page(wayID).Valid {
+		return false
+	}
+
+	pid := set.Page(wayID).PID
+	start, end := pwc.entryRange(set, wayID)
+	for _, r := range ranges {
+		if r.overlaps(pid, start, end) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pinnedWay identifies a way of a set.
+type pinnedWay struct {
+	set   Set
+	wayID int
+}
+
+// waysToPin returns the ways that tryPin would pin if the pinned ranges were
+// ranges.
+func (pwc *PWC) waysToPin(ranges []pinRange) []pinnedWay {
+	var ways []pinnedWay
+	for _, set := range pwc.Sets {
+		numPinned := set.NumPinned()
+		for wayID := 0; wayID < pwc.numWays; wayID++ {
+			if set.IsPinned(wayID) || numPinned >= pwc.maxPinnedWays ||
+				!pwc.isInRanges(ranges, set, wayID) {
+				continue
+			}
+
+			ways = append(ways, pinnedWay{set: set, wayID: wayID})
+			numPinned++
+		}
+	}
+
+	return ways
+}
+
+// waysToUnpin returns the pinned ways that fall outside ranges.
+func (pwc *PWC) waysToUnpin(ranges []pinRange) []pinnedWay {
+	var ways []pinnedWay
+	for _, set := range pwc.Sets {
+		for wayID := 0; wayID < pwc.numWays; wayID++ {
+			if set.IsPinned(wayID) && !pwc.isInRanges(ranges, set, wayID) {
+				ways = append(ways, pinnedWay{set: set, wayID: wayID})
+			}
+		}
+	}
+
+	return ways
+}
+
+// tryPin pins the way if its entry falls in a pinned range and the set has not
+// reached the cap on pinned ways.
+func (pwc *PWC) tryPin(set Set, wayID int) bool {
+	if set.IsPinned(wayID) || set.NumPinned() >= pwc.maxPinnedWays {
+		return false
+	}
+
+	if !pwc.isInPinnedRange(set, wayID) {
+		return false
+	}
+
+	set.Pin(wayID)
+	return true
+}
+
+// handlePinReq pins the entries of the range. Like a flush, the request
+// changes the PWC only once the response is sent.
+func (pwc *PWC) handlePinReq(now sim.VTimeInSec, req *PinReq) bool {
+	ranges := append([]pinRange(nil), pwc.pinnedRanges...)
+	ranges = append(ranges,
+		pinRange{pid: req.PID, start: req.VAddr, end: req.VAddr + req.Size})
+	ways := pwc.waysToPin(ranges)
+	if !pwc.sendPinRsp(now, req.Src, len(ways)) {
+		return false
+	}
+
+	pwc.pinnedRanges = ranges
+	for _, w := range ways {
+		w.set.Pin(w.wayID)
+	}
+
+	return true
+}
+
+// handleUnpinReq removes the range from the pinned ranges, splitting the
+// ranges that extend past it, and unpins the entries left outside every
+// pinned range.
+func (pwc *PWC) handleUnpinReq(now sim.VTimeInSec, req *UnpinReq) bool {
+	var ranges []pinRange
+	for _, r := range pwc.pinnedRanges {
+		ranges = append(ranges, r.without(req.PID, req.VAddr, req.VAddr+req.Size)...)
+	}
+
+	ways := pwc.waysToUnpin(ranges)
+	if !pwc.sendPinRsp(now, req.Src, len(ways)) {
+		return false
+	}
+
+	pwc.pinnedRanges = ranges
+	for _, w := range ways {
+		w.set.Unpin(w.wayID)
+	}
+
+	return true
+}
+
+func (pwc *PWC) sendPinRsp(now sim.VTimeInSec, dst sim.Port, n int) bool {
+	rsp := PinRspBuilder{}.
+		WithSendTime(now).
+		WithSrc(pwc.controlPort).
+		WithDst(dst).
+		WithNumPinned(n).
+		Build()
+
+	err := pwc.controlPort.Send(rsp)
+	return err == nil
+}
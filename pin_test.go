@@ -0,0 +1,140 @@
+package pwcache
+
+import (
+	"testing"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+// pin sends a PinReq for [vAddr, vAddr+size) of the process and returns the
+// number of entries that the response reports as pinned.
+func (h *pwcHarness) pin(pid vm.PID, vAddr, size uint64) int {
+	h.control(PinReqBuilder{}.WithPID(pid).WithVAddr(vAddr).WithSize(size).
+		Build())
+	h.run()
+	return h.lastPinRsp().NumPinned
+}
+
+// unpin sends an UnpinReq for [vAddr, vAddr+size) of the process and returns
+// the number of entries that the response reports as unpinned.
+func (h *pwcHarness) unpin(pid vm.PID, vAddr, size uint64) int {
+	h.control(UnpinReqBuilder{}.WithPID(pid).WithVAddr(vAddr).WithSize(size).
+		Build())
+	h.run()
+	return h.lastPinRsp().NumPinned
+}
+
+func (h *pwcHarness) lastPinRsp() *PinRsp {
+	for i := len(h.ctrl.received) - 1; i >= 0; i-- {
+		if rsp, ok := h.ctrl.received[i].(*PinRsp); ok {
+			return rsp
+		}
+	}
+
+	h.t.Fatal("no PinRsp received")
+	return nil
+}
+
+// isPinned reports whether the entry of the level that translates vAddr is
+// cached and pinned.
+func (h *pwcHarness) isPinned(pid vm.PID, vAddr uint64, level int) bool {
+	prefix := h.pwc.prefix(vAddr, level)
+	set := h.pwc.Sets[h.pwc.vAddrToSetID(prefix, level)]
+	wayID, _, found := set.Lookup(pid, prefix, level)
+	return found && set.IsPinned(wayID)
+}
+
+func TestPinReqPinsCachedEntries(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	h.translate(1, baseVAddr)
+	h.run()
+
+	if got := h.pin(1, baseVAddr, 0x1000); got != 3 {
+		t.Errorf("pinned %d entries, want 3", got)
+	}
+
+	for _, level := range cachedLevels {
+		if !h.isPinned(1, baseVAddr, level) {
+			t.Errorf("level %d entry is not pinned", level)
+		}
+	}
+
+	if got := h.pin(2, baseVAddr, 0x1000); got != 0 {
+		t.Errorf("pinned %d entries of another process, want 0", got)
+	}
+}
+
+func TestUnpinReqSplitsPinnedRanges(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	h.pin(1, 0, 2<<21)
+	h.translate(1, baseVAddr)
+	h.run()
+	h.translate(1, sameL3VAddr)
+	h.run()
+
+	if got := h.unpin(1, 0, 1<<21); got != 1 {
+		t.Errorf("unpinned %d entries, want 1", got)
+	}
+
+	if h.isPinned(1, baseVAddr, LevelL2) {
+		t.Error("the L2 entry of the unpinned range is still pinned")
+	}
+
+	for _, level := range []int{LevelL4, LevelL3} {
+		if !h.isPinned(1, sameL3VAddr, level) {
+			t.Errorf("level %d entry was unpinned", level)
+		}
+	}
+
+	if !h.isPinned(1, sameL3VAddr, LevelL2) {
+		t.Error("the L2 entry of the rest of the range was unpinned")
+	}
+}
+
+func TestFlushUnpinsInvalidatedEntries(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	h.translate(1, baseVAddr)
+	h.run()
+	h.pin(1, baseVAddr, 0x1000)
+
+	h.control(FlushReqBuilder{}.
+		WithPID(1).
+		WithVAddrs([]uint64{baseVAddr}).
+		Build())
+	h.run()
+
+	if got := h.pwc.Sets[0].NumPinned(); got != 0 {
+		t.Errorf("%d invalidated entries are still pinned", got)
+	}
+
+	h.control(RestartReqBuilder{}.Build())
+	h.run()
+	h.translate(1, baseVAddr)
+	h.run()
+
+	for _, level := range cachedLevels {
+		if !h.isPinned(1, baseVAddr, level) {
+			t.Errorf("refilled level %d entry is not pinned again", level)
+		}
+	}
+}
+
+func TestPinReqSkipsInvalidatedEntries(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	h.translate(1, baseVAddr)
+	h.run()
+
+	h.control(FlushReqBuilder{}.
+		WithPID(1).
+		WithVAddrs([]uint64{baseVAddr}).
+		Build())
+	h.run()
+
+	if got := h.pin(1, baseVAddr, 0x1000); got != 0 {
+		t.Errorf("pinned %d invalidated entries, want 0", got)
+	}
+
+	if got := h.pwc.Sets[0].NumPinned(); got != 0 {
+		t.Errorf("%d invalidated entries are pinned", got)
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"github.com/sarchlab/akita/v3/sim"
 )
 
-// A FlushReq asks the TLB to invalidate certain entries. It will also not block all incoming and outgoing ports
+// A FlushReq asks the PWC to invalidate the entries of PID on the walk path of
+// each address in VAddr, that is, its L4, L3 and L2 entries. The entries of
+// the upper levels are shared with the neighbouring addresses, whose next
+// walks then miss them too. The PWC also drops the requests in flight and
+// stops taking new ones until a RestartReq.
 type FlushReq struct {
 	sim.MsgMeta
 	VAddr []uint64
@@ -209,3 +213,202 @@ func (b RestartRspBuilder) Build() *RestartRsp {
 
 	return r
 }
+
+// A PinReq asks the PWC to keep the entries that translate a range of virtual
+// addresses of a process resident. Entries in the range that are filled later
+// are pinned as well.
+type PinReq struct {
+	sim.MsgMeta
+	PID   vm.PID
+	VAddr uint64
+	Size  uint64
+}
+
+// Meta returns the meta data associated with the message.
+func (r *PinReq) Meta() *sim.MsgMeta {
+	return &r.MsgMeta
+}
+
+// PinReqBuilder can build PWC pin requests.
+type PinReqBuilder struct {
+	sendTime sim.VTimeInSec
+	src, dst sim.Port
+	pid      vm.PID
+	vAddr    uint64
+	size     uint64
+}
+
+// WithSendTime sets the send time of the request to build.
+func (b PinReqBuilder) WithSendTime(t sim.VTimeInSec) PinReqBuilder {
+	b.sendTime = t
+	return b
+}
+
+// WithSrc sets the source of the request to build.
+func (b PinReqBuilder) WithSrc(src sim.Port) PinReqBuilder {
+	b.src = src
+	return b
+}
+
+// WithDst sets the destination of the request to build.
+func (b PinReqBuilder) WithDst(dst sim.Port) PinReqBuilder {
+	b.dst = dst
+	return b
+}
+
+// WithPID sets the pid whose entries are to be pinned.
+func (b PinReqBuilder) WithPID(pid vm.PID) PinReqBuilder {
+	b.pid = pid
+	return b
+}
+
+// WithVAddr sets the start of the virtual address range to pin.
+func (b PinReqBuilder) WithVAddr(vAddr uint64) PinReqBuilder {
+	b.vAddr = vAddr
+	return b
+}
+
+// WithSize sets the size in bytes of the virtual address range to pin.
+func (b PinReqBuilder) WithSize(size uint64) PinReqBuilder {
+	b.size = size
+	return b
+}
+
+// Build creates a new PinReq.
+func (b PinReqBuilder) Build() *PinReq {
+	r := &PinReq{}
+	r.ID = sim.GetIDGenerator().Generate()
+	r.Src = b.src
+	r.Dst = b.dst
+	r.SendTime = b.sendTime
+	r.PID = b.pid
+	r.VAddr = b.vAddr
+	r.Size = b.size
+	return r
+}
+
+// A PinRsp is a response from the PWC indicating a pin or an unpin request is
+// complete. NumPinned is the number of entries whose pinned state changed.
+type PinRsp struct {
+	sim.MsgMeta
+	NumPinned int
+}
+
+// Meta returns the meta data associated with the message.
+func (r *PinRsp) Meta() *sim.MsgMeta {
+	return &r.MsgMeta
+}
+
+// PinRspBuilder can build PWC pin responses.
+type PinRspBuilder struct {
+	sendTime  sim.VTimeInSec
+	src, dst  sim.Port
+	numPinned int
+}
+
+// WithSendTime sets the send time of the respond to build.
+func (b PinRspBuilder) WithSendTime(t sim.VTimeInSec) PinRspBuilder {
+	b.sendTime = t
+	return b
+}
+
+// WithSrc sets the source of the respond to build.
+func (b PinRspBuilder) WithSrc(src sim.Port) PinRspBuilder {
+	b.src = src
+	return b
+}
+
+// WithDst sets the destination of the respond to build.
+func (b PinRspBuilder) WithDst(dst sim.Port) PinRspBuilder {
+	b.dst = dst
+	return b
+}
+
+// WithNumPinned sets the number of entries affected by the request.
+func (b PinRspBuilder) WithNumPinned(n int) PinRspBuilder {
+	b.numPinned = n
+	return b
+}
+
+// Build creates a new PinRsp.
+func (b PinRspBuilder) Build() *PinRsp {
+	r := &PinRsp{}
+	r.ID = sim.GetIDGenerator().Generate()
+	r.Src = b.src
+	r.Dst = b.dst
+	r.SendTime = b.sendTime
+	r.NumPinned = b.numPinned
+	return r
+}
+
+// An UnpinReq asks the PWC to release the entries pinned for a range of
+// virtual addresses of a process.
+type UnpinReq struct {
+	sim.MsgMeta
+	PID   vm.PID
+	VAddr uint64
+	Size  uint64
+}
+
+// Meta returns the meta data associated with the message.
+func (r *UnpinReq) Meta() *sim.MsgMeta {
+	return &r.MsgMeta
+}
+
+// UnpinReqBuilder can build PWC unpin requests.
+type UnpinReqBuilder struct {
+	sendTime sim.VTimeInSec
+	src, dst sim.Port
+	pid      vm.PID
+	vAddr    uint64
+	size     uint64
+}
+
+// WithSendTime sets the send time of the request to build.
+func (b UnpinReqBuilder) WithSendTime(t sim.VTimeInSec) UnpinReqBuilder {
+	b.sendTime = t
+	return b
+}
+
+// WithSrc sets the source of the request to build.
+func (b UnpinReqBuilder) WithSrc(src sim.Port) UnpinReqBuilder {
+	b.src = src
+	return b
+}
+
+// WithDst sets the destination of the request to build.
+func (b UnpinReqBuilder) WithDst(dst sim.Port) UnpinReqBuilder {
+	b.dst = dst
+	return b
+}
+
+// WithPID sets the pid whose entries are to be unpinned.
+func (b UnpinReqBuilder) WithPID(pid vm.PID) UnpinReqBuilder {
+	b.pid = pid
+	return b
+}
+
+// WithVAddr sets the start of the virtual address range to unpin.
+func (b UnpinReqBuilder) WithVAddr(vAddr uint64) UnpinReqBuilder {
+	b.vAddr = vAddr
+	return b
+}
+
+// WithSize sets the size in bytes of the virtual address range to unpin.
+func (b UnpinReqBuilder) WithSize(size uint64) UnpinReqBuilder {
+	b.size = size
+	return b
+}
+
+// Build creates a new UnpinReq.
+func (b UnpinReqBuilder) Build() *UnpinReq {
+	r := &UnpinReq{}
+	r.ID = sim.GetIDGenerator().Generate()
+	r.Src = b.src
+	r.Dst = b.dst
+	r.SendTime = b.sendTime
+	r.PID = b.pid
+	r.VAddr = b.vAddr
+	r.Size = b.size
+	return r
+}
@@ -16,6 +16,7 @@ type PWC struct {
 	*sim.TickingComponent
 
 	topPort     sim.Port
+	topPorts    []sim.Port
 	bottomPort  sim.Port
 	controlPort sim.Port
 	LowModule   sim.Port
@@ -25,12 +26,44 @@ type PWC struct {
 	pageSize       uint64
 	numReqPerCycle int
 	log2PageSize   uint64
+	numWalkers     int
+	lookupLatency  int
+	levelLatency   int
 
 	Sets []Set
 
 	mshr                mshr
 	respondingMSHREntry *mshrEntry
 	pwqueue             *pwqueue.PWQueue
+	partition           *wayPartition
+	insertion           InsertionPolicy
+	replacement         ReplacementPolicy
+	future              *futureUses
+	dueling             *setDueling
+	numBIPFills         uint64
+	costWeights         [numLevels]int
+	reuseFilter         *reuseFilter
+	maxPinnedWays       int
+	pinnedRanges        []pinRange
+	numMSHREntry        int
+	arbiter             *deviceArbiter
+	sharing             SharingPolicy
+	deviceWayQuota      int
+	nextTopPort         int
+	selectedTopPort     sim.Port
+
+	stats          Stats
+	latencies      Latencies
+	missClassifier *missClassifier
+	reuseProfiler  *reuseProfiler
+	shadows        []*PWC
+
+	onViolation ViolationHandler
+	lookupMode  LookupMode
+	recorder    *Recorder
+
+	warmingUp  bool
+	openPhases map[string]string
 
 	isPaused bool
 }
@@ -55,11 +88,13 @@ func (pwc *PWC) Tick(now sim.VTimeInSec) bool {
 			madeProgress = pwc.respondMSHREntry(now) || madeProgress
 		}
 
+		madeProgress = pwc.acceptTopReqs(now) || madeProgress
+
 		for i := 0; i < pwc.numReqPerCycle; i++ {
 			madeProgress = pwc.MSHRlookup(now) || madeProgress
 		}
 
-		for i := 0; i < 8; i++ { //GMMU 8个page table walker
+		for i := 0; i < pwc.numWalkers; i++ { //GMMU page table walker
 			madeProgress = pwc.PWClookup(now, i) || madeProgress
 		}
 
@@ -68,6 +103,10 @@ func (pwc *PWC) Tick(now sim.VTimeInSec) bool {
 		}
 	}
 
+	if pwc.onViolation != nil {
+		pwc.checkInvariants(now)
+	}
+
 	return madeProgress
 }
 
@@ -79,14 +118,15 @@ func (pwc *PWC) respondMSHREntry(now sim.VTimeInSec) bool { //正返回的mshr
 	mshrEntry := pwc.respondingMSHREntry
 	page := mshrEntry.page
 	req := mshrEntry.Requests[0]
+	port := pwc.replyPort(req)
 	rspToTop := vm.TranslationRspBuilder{}.
 		WithSendTime(now).
-		WithSrc(pwc.topPort).
+		WithSrc(port).
 		WithDst(req.Src).
 		WithRspTo(req.ID).
 		WithPage(page).
 		Build()
-	err := pwc.topPort.Send(rspToTop)
+	err := port.Send(rspToTop)
 	if err != nil {
 		return false
 	}
@@ -96,24 +136,32 @@ func (pwc *PWC) respondMSHREntry(now sim.VTimeInSec) bool { //正返回的mshr
 		pwc.respondingMSHREntry = nil
 	}
 
+	pwc.recordLatency(now, req, mshrEntry)
+	if pwc.recorder != nil {
+		pwc.recorder.complete(now, req, mshrEntry.hitlevel)
+	}
+
+	pwc.endPhase(req)
 	tracing.TraceReqComplete(req, pwc)
 	return true
 }
 
 func (pwc *PWC) MSHRlookup(now sim.VTimeInSec) bool { //在mshr中查找
-	msg := pwc.topPort.Peek()
-	if msg == nil {
+	req := pwc.peekTopReq()
+	if req == nil {
 		return false
 	}
 
-	req := msg.(*vm.TranslationReq)
-
 	mshrEntry := pwc.mshr.Query(req.PID, req.VAddr) //在mshr中查找
 	if mshrEntry != nil {                           //如果找到了
 		return pwc.processPWCMSHRHit(now, mshrEntry, req) //处理mshr命中
-	} else {
-		return pwc.processPWCMSHRMISS(now, req)
 	}
+
+	if pwc.mshr.IsFull() || pwc.pwqueue.IsFull() {
+		return false
+	}
+
+	return pwc.processPWCMSHRMISS(now, req)
 }
 func (pwc *PWC) PWClookup(now sim.VTimeInSec, i int) bool {
 	pwe, err := pwc.pwqueue.Index(i)
@@ -121,6 +169,11 @@ func (pwc *PWC) PWClookup(now sim.VTimeInSec, i int) bool {
 		return false
 	}
 
+	if !pwe.Inpwcache && pwe.Cyclesleft == pwc.lookupLatency { //walker开始处理
+		pwc.mshr.Query(pwe.Req.PID, pwe.Req.VAddr).lookupStart = now
+		pwc.startPhase(pwe.Req, taskKindLookup, "sets")
+	}
+
 	if pwe.Cyclesleft != 0 { //未达到pwc的访问延迟
 		pwe.Cyclesleft--
 		return true
@@ -132,61 +185,89 @@ func (pwc *PWC) PWClookup(now sim.VTimeInSec, i int) bool {
 
 	pwe.Inpwcache = true
 	req := pwe.Req
-	l4index := req.VAddr >> (pwc.log2PageSize + 27) << (pwc.log2PageSize + 27)
-	l3index := req.VAddr >> (pwc.log2PageSize + 18) << (pwc.log2PageSize + 18)
-	l2index := req.VAddr >> (pwc.log2PageSize + 9) << (pwc.log2PageSize + 9)
 
-	setID := pwc.vAddrToSetID(l2index) //计算setID
-	set := pwc.Sets[setID]
-	wayID, _, foundl2 := set.Lookup(req.PID, l2index) //在set中查找
-
-	if foundl2 {
-		pwc.visit(setID, wayID)
-		pwc.pwqueue.Updatehitl(i, 3)
-		tracing.TraceReqReceive(req, pwc)
-		tracing.AddTaskStep(tracing.MsgIDAtReceiver(req, pwc), pwc, "l2-hit")
-		//fmt.Println("l2 hit")
-		_ = pwc.fetchBottom(now, req, 3)
+	if e := pwc.mshr.Query(req.PID, req.VAddr); e.replay {
+		e.replay = false
+		_ = pwc.fetchBottom(now, req, e.hitlevel)
 		return true
 	}
 
-	setID = pwc.vAddrToSetID(l3index) //计算setID
-	set = pwc.Sets[setID]
-	wayID, _, foundl3 := set.Lookup(req.PID, l3index) //在set中查找
+	found := pwc.lookup(req.PID, req.VAddr)
+	pwc.classifyMisses(req.PID, req.VAddr, found)
+	pwc.profileReuse(req.PID, req.VAddr)
+	pwc.shadowLookup(req.PID, req.VAddr)
+	pwc.completeLookup(now, i, req, found, pwc.applyLookupMode(found))
+	return true
+}
+
+// lookup probes the sets from the deepest level to the shallowest and returns
+// the level of the first valid entry that translates vAddr, visiting it.
+func (pwc *PWC) lookup(pid vm.PID, vAddr uint64) (hitlevel int) {
+	for _, level := range cachedLevels {
+		prefix := pwc.prefix(vAddr, level)
+		setID := pwc.vAddrToSetID(prefix, level) //计算setID
+		set := pwc.Sets[setID]
+		wayID, page, found := set.Lookup(pid, prefix, level) //在set中查找
+		hit := found && page.Valid
+		if pwc.dueling != nil {
+			pwc.dueling.recordProbe(setID, hit)
+		}
+
+		if !hit {
+			continue
+		}
 
-	if foundl3 {
 		pwc.visit(setID, wayID)
-		pwc.pwqueue.Updatehitl(i, 2)
-		tracing.TraceReqReceive(req, pwc)
-		tracing.AddTaskStep(tracing.MsgIDAtReceiver(req, pwc), pwc, "l3-hit")
-		//fmt.Println("l3 hit")
-		_ = pwc.fetchBottom(now, req, 2)
-		return true
+		return level
 	}
 
-	setID = pwc.vAddrToSetID(l4index) //计算setID
-	set = pwc.Sets[setID]
-	wayID, _, foundl4 := set.Lookup(req.PID, l4index) //在set中查找
+	return LevelNone
+}
 
-	if foundl4 {
-		pwc.visit(setID, wayID)
-		pwc.pwqueue.Updatehitl(i, 1)
-		tracing.TraceReqReceive(req, pwc)
-		tracing.AddTaskStep(tracing.MsgIDAtReceiver(req, pwc), pwc, "l4-hit")
-		//fmt.Println("l4 hit")
-		_ = pwc.fetchBottom(now, req, 1)
-		return true
+// completeLookup records the hit level of the i-th pwqueue entry and sends the
+// remaining part of the walk to the low module. The statistics and the way
+// partition account the level found in the sets, while the walk and its
+// timing follow hitlevel, which the lookup mode may override.
+func (pwc *PWC) completeLookup(
+	now sim.VTimeInSec,
+	i int,
+	req *vm.TranslationReq,
+	found, hitlevel int,
+) {
+	pwc.recordLookup(found)
+	pwc.pwqueue.Updatehitl(i, hitlevel)
+	mshrEntry := pwc.mshr.Query(req.PID, req.VAddr)
+	mshrEntry.hitlevel = hitlevel
+	mshrEntry.lookupEnd = now
+	pwc.invokeHook(HookPosLookup, req, LookupDetail{
+		PID:      req.PID,
+		VAddr:    req.VAddr,
+		HitLevel: hitlevel,
+	})
+
+	step := "miss"
+	if hitlevel != LevelNone {
+		step = levelNames[hitlevel] + "-hit"
 	}
-	pwc.pwqueue.Updatehitl(i, 0)
-	tracing.TraceReqReceive(req, pwc)
-	tracing.AddTaskStep(tracing.MsgIDAtReceiver(req, pwc), pwc, "miss")
-	//fmt.Println("miss")
-	_ = pwc.fetchBottom(now, req, 0)
-	return true
+
+	tracing.AddTaskStep(tracing.MsgIDAtReceiver(req, pwc), pwc, step)
+	pwc.endPhase(req)
+	_ = pwc.fetchBottom(now, req, hitlevel)
 }
 
-func (pwc *PWC) vAddrToSetID(vAddr uint64) (setID int) {
-	return int(vAddr / pwc.pageSize % uint64(pwc.numSets))
+// recordLookup accounts the outcome of a lookup in the statistics and in the
+// structures that adapt to the hit levels.
+func (pwc *PWC) recordLookup(hitlevel int) {
+	pwc.stats.Lookups++
+	pwc.stats.LevelHits[hitlevel]++
+	pwc.partition.recordLookup(hitlevel)
+}
+
+// vAddrToSetID returns the set that holds the entry of the given level for
+// vAddr. The set is indexed by the lowest bits of the prefix of the level,
+// since the bits below them are the same for all the entries of the level.
+func (pwc *PWC) vAddrToSetID(vAddr uint64, level int) (setID int) {
+	return int((vAddr >> pwc.levelShift(level)) % uint64(pwc.numSets))
 }
 
 func (pwc *PWC) processPWCMSHRHit( //处理MSHR命中
@@ -197,9 +278,20 @@ func (pwc *PWC) processPWCMSHRHit( //处理MSHR命中
 
 	mshrEntry.Requests = append(mshrEntry.Requests, req)
 
-	pwc.topPort.Retrieve(now)
+	pwc.retrieveTopReq(now)
+	if pwc.recorder != nil {
+		pwc.recorder.arrive(req, true)
+	}
+
+	pwc.invokeHook(HookPosMSHRMerge, req, MSHRMergeDetail{
+		PID:       mshrEntry.pid,
+		VAddr:     mshrEntry.vAddr,
+		NumMerged: len(mshrEntry.Requests),
+	})
+
 	tracing.TraceReqReceive(req, pwc)
 	tracing.AddTaskStep(tracing.MsgIDAtReceiver(req, pwc), pwc, "mshr-hit")
+	pwc.startPhase(req, taskKindQueueWait, "mshr")
 
 	return true
 }
@@ -209,13 +301,23 @@ func (pwc *PWC) processPWCMSHRMISS( //处理MSHR未命中
 	req *vm.TranslationReq,
 ) bool {
 	mshrEntry := pwc.mshr.Add(req.PID, req.VAddr) //把查找请求加入mshr
+	mshrEntry.deviceID = req.DeviceID
 	mshrEntry.Requests = append(mshrEntry.Requests, req)
+	if pwc.future != nil {
+		mshrEntry.tracePos = pwc.future.numArrived
+	}
+
+	pwc.retrieveTopReq(now)
+	if pwc.recorder != nil {
+		pwc.recorder.arrive(req, false)
+	}
 
-	pwc.topPort.Retrieve(now)
 	tracing.TraceReqReceive(req, pwc)
 	tracing.AddTaskStep(tracing.MsgIDAtReceiver(req, pwc), pwc, "mshr-miss")
+	pwc.startPhase(req, taskKindQueueWait, "pwqueue")
 
 	pwq := pwqueue.Newpwqueueentry(req, 0) //把查找请求加入pwcache
+	pwq.Cyclesleft = pwc.lookupLatency
 	err := pwc.pwqueue.Enqueue(pwq)
 	if err != nil {
 		return false
@@ -241,7 +343,7 @@ func (pwc *PWC) fetchBottom(now sim.VTimeInSec, req *vm.TranslationReq, hitlevel
 		WithPID(req.PID).
 		WithVAddr(req.VAddr).
 		WithDeviceID(req.DeviceID).
-		WithLantency(100 * (4 - hitlevel)).
+		WithLantency(pwc.levelLatency * (4 - hitlevel)).
 		WithReq(Req).
 		Build()
 	err := pwc.bottomPort.Send(fetchBottom)
@@ -254,6 +356,7 @@ func (pwc *PWC) fetchBottom(now sim.VTimeInSec, req *vm.TranslationReq, hitlevel
 
 	tracing.TraceReqInitiate(fetchBottom, pwc,
 		tracing.MsgIDAtReceiver(req, pwc))
+	mshrEntry.walk = pwc.traceWalk(now, fetchBottom, hitlevel)
 
 	return true
 }
@@ -271,60 +374,46 @@ func (pwc *PWC) parseBottom(now sim.VTimeInSec) bool { //解析bottom传回的rs
 	rsp := item.(*vm.TranslationRsp)
 	page := rsp.Page
 
-	mshrEntryPresent := pwc.mshr.IsEntryPresent(rsp.Page.PID, rsp.Page.VAddr)
-	if !mshrEntryPresent {
+	mshrEntry := pwc.walkAnsweredBy(rsp)
+	if mshrEntry == nil {
 		pwc.bottomPort.Retrieve(now)
 		return true
 	}
-	l4index := page.VAddr >> (pwc.log2PageSize + 27) << (pwc.log2PageSize + 27)
-	l3index := page.VAddr >> (pwc.log2PageSize + 18) << (pwc.log2PageSize + 18)
-	l2index := page.VAddr >> (pwc.log2PageSize + 9) << (pwc.log2PageSize + 9)
-
-	setID := pwc.vAddrToSetID(l4index)
-	set := pwc.Sets[setID]
-	wayID, ok := pwc.Sets[setID].Evict()
-	if !ok {
-		panic("failed to evict")
-	}
-	page4 := page
-	page4.VAddr = l4index
-	set.Update(wayID, page4) //把l4index保存在PWC中
-	set.Visit(wayID)
-
-	setID = pwc.vAddrToSetID(l3index)
-	set = pwc.Sets[setID]
-	wayID, ok = pwc.Sets[setID].Evict()
-	if !ok {
-		panic("failed to evict")
+	if pwc.future != nil {
+		pwc.future.pos = mshrEntry.tracePos + 1
 	}
-	page3 := page
-	page3.VAddr = l3index
-	set.Update(wayID, page3) //把l3index页表项保存在PWC中
-	set.Visit(wayID)
+	pwc.fillWalk(page, mshrEntry.deviceID) //把各级前缀保存在PWC中
 
-	setID = pwc.vAddrToSetID(l2index)
-	set = pwc.Sets[setID]
-	wayID, ok = pwc.Sets[setID].Evict()
-	if !ok {
-		panic("failed to evict")
-	}
-	page2 := page
-	page2.VAddr = l2index
-	set.Update(wayID, page2) //把l2index保存在PWC中
-	set.Visit(wayID)
-
-	mshrEntry := pwc.mshr.GetEntry(rsp.Page.PID, rsp.Page.VAddr)
 	pwc.respondingMSHREntry = mshrEntry
 	mshrEntry.page = page
+	mshrEntry.walkDone = rsp.RecvTime
 
-	pwc.mshr.Remove(rsp.Page.PID, rsp.Page.VAddr)    //从mshr中移除
-	pwc.pwqueue.Remove(rsp.Page.PID, rsp.Page.VAddr) //从pwqueue中移除
+	pwc.mshr.Remove(mshrEntry.pid, mshrEntry.vAddr)    //从mshr中移除
+	pwc.pwqueue.Remove(mshrEntry.pid, mshrEntry.vAddr) //从pwqueue中移除
 	pwc.bottomPort.Retrieve(now)
+	pwc.endWalk(mshrEntry.walk)
 	tracing.TraceReqFinalize(mshrEntry.reqToBottom, pwc)
+	for _, req := range mshrEntry.Requests {
+		pwc.startPhase(req, taskKindRespond, "rsp")
+	}
 
 	return true
 }
 
+// walkAnsweredBy returns the MSHR entry whose walk the response answers, or
+// nil if the walk was dropped by a flush. The entry is found by the ID of the
+// walk rather than by the address of the page, which the low module aligns to
+// the page boundary while the entry keeps the address of the request.
+func (pwc *PWC) walkAnsweredBy(rsp *vm.TranslationRsp) *mshrEntry {
+	for _, e := range pwc.mshr.AllEntries() {
+		if e.reqToBottom != nil && e.reqToBottom.ID == rsp.RespondTo {
+			return e
+		}
+	}
+
+	return nil
+}
+
 func (pwc *PWC) performCtrlReq(now sim.VTimeInSec) bool { //处理控制请求
 	item := pwc.controlPort.Peek()
 	if item == nil {
@@ -338,6 +427,10 @@ func (pwc *PWC) performCtrlReq(now sim.VTimeInSec) bool { //处理控制请求
 		return pwc.handlePWCFlush(now, req)
 	case *RestartReq:
 		return pwc.handlePWCRestart(now, req)
+	case *PinReq:
+		return pwc.handlePinReq(now, req)
+	case *UnpinReq:
+		return pwc.handleUnpinReq(now, req)
 	default:
 		log.Panicf("cannot process request %s", reflect.TypeOf(req))
 	}
@@ -350,6 +443,9 @@ func (pwc *PWC) visit(setID, wayID int) {
 	set.Visit(wayID)
 }
 
+// handlePWCFlush invalidates the path of every address of the flush, rather
+// than only the entries keyed by the addresses themselves, since an address
+// is never the prefix of an entry unless it is aligned to the level.
 func (pwc *PWC) handlePWCFlush(now sim.VTimeInSec, req *FlushReq) bool {
 	rsp := FlushRspBuilder{}.
 		WithSrc(pwc.controlPort).
@@ -362,21 +458,59 @@ func (pwc *PWC) handlePWCFlush(now sim.VTimeInSec, req *FlushReq) bool {
 		return false
 	}
 
+	detail := FlushDetail{PID: req.PID, VAddrs: req.VAddr}
 	for _, vAddr := range req.VAddr {
-		setID := pwc.vAddrToSetID(vAddr)
-		set := pwc.Sets[setID]
-		wayID, page, found := set.Lookup(req.PID, vAddr)
+		detail.Invalidated += pwc.invalidatePath(req.PID, vAddr)
+	}
+
+	for _, e := range pwc.mshr.AllEntries() {
+		detail.NumDropped += len(e.Requests)
+		pwc.abortTraces(e)
+		if pwc.recorder != nil {
+			for _, r := range e.Requests {
+				pwc.recorder.drop(r)
+			}
+		}
+	}
+
+	pwc.mshr.Reset()
+	pwc.pwqueue.Reset()
+	pwc.isPaused = true
+	pwc.invokeHook(HookPosFlush, req, detail)
+	return true
+}
+
+// invalidatePath invalidates the entries of every level that translate vAddr,
+// also in the shadows, and returns how many were valid in the sets. The
+// invalidated entries are unpinned; a refill pins them again if they are
+// still in a pinned range.
+func (pwc *PWC) invalidatePath(pid vm.PID, vAddr uint64) int {
+	for _, s := range pwc.shadows {
+		s.invalidatePath(pid, vAddr)
+	}
+
+	n := 0
+	for _, level := range cachedLevels {
+		prefix := pwc.prefix(vAddr, level)
+		set := pwc.Sets[pwc.vAddrToSetID(prefix, level)]
+		wayID, page, found := set.Lookup(pid, prefix, level)
 		if !found {
 			continue
 		}
 
+		if page.Valid {
+			n++
+		}
+
 		page.Valid = false
-		set.Update(wayID, page)
+		set.Update(wayID, page, level)
+		if set.IsPinned(wayID) {
+			set.Unpin(wayID)
+		}
+		pwc.removeShadow(pid, prefix, level)
 	}
 
-	pwc.mshr.Reset()
-	pwc.isPaused = true
-	return true
+	return n
 }
 
 func (pwc *PWC) handlePWCRestart(now sim.VTimeInSec, req *RestartReq) bool {
@@ -393,13 +527,12 @@ func (pwc *PWC) handlePWCRestart(now sim.VTimeInSec, req *RestartReq) bool {
 
 	pwc.isPaused = false
 
-	for pwc.topPort.Retrieve(now) != nil {
-		pwc.topPort.Retrieve(now)
-	}
+	numDrained := pwc.drainTopPorts(now)
 
 	for pwc.bottomPort.Retrieve(now) != nil {
 		pwc.bottomPort.Retrieve(now)
 	}
 
+	pwc.invokeHook(HookPosRestart, req, RestartDetail{NumDrained: numDrained})
 	return true
 }
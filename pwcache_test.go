@@ -0,0 +1,257 @@
+package pwcache
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+// Addresses that share a prefix with baseVAddr down to a given level under
+// 4KB pages.
+const (
+	baseVAddr    = uint64(0x1000)
+	sameL2VAddr  = baseVAddr + 0x1000
+	sameL3VAddr  = baseVAddr + 1<<21
+	sameL4VAddr  = baseVAddr + 1<<30
+	otherL4VAddr = baseVAddr + 1<<39
+)
+
+func TestPWCMissWalksAllLevels(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+
+	req := h.translate(1, baseVAddr)
+	h.run()
+
+	if got := h.walkLatencies(); !reflect.DeepEqual(got, []int{400}) {
+		t.Errorf("walk latencies = %v, want [400]", got)
+	}
+
+	rsps := h.top.translationRsps()
+	if len(rsps) != 1 {
+		t.Fatalf("got %d responses, want 1", len(rsps))
+	}
+
+	if rsps[0].RespondTo != req.ID {
+		t.Errorf("response to %s, want %s", rsps[0].RespondTo, req.ID)
+	}
+
+	if rsps[0].Page != scriptedPage(1, baseVAddr) {
+		t.Errorf("page = %+v, want %+v", rsps[0].Page, scriptedPage(1, baseVAddr))
+	}
+
+	if h.pwc.Stats().LevelHits[LevelNone] != 1 {
+		t.Errorf("misses = %d, want 1", h.pwc.Stats().LevelHits[LevelNone])
+	}
+}
+
+func TestPWCHitLevels(t *testing.T) {
+	cases := []struct {
+		name    string
+		vAddr   uint64
+		level   int
+		latency int
+	}{
+		{"l2", sameL2VAddr, LevelL2, 100},
+		{"l3", sameL3VAddr, LevelL3, 200},
+		{"l4", sameL4VAddr, LevelL4, 300},
+		{"miss", otherL4VAddr, LevelNone, 400},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := newPWCHarness(t, MakeBuilder())
+			h.translate(1, baseVAddr)
+			h.run()
+
+			h.translate(1, c.vAddr)
+			h.run()
+
+			want := []int{400, c.latency}
+			if got := h.walkLatencies(); !reflect.DeepEqual(got, want) {
+				t.Errorf("walk latencies = %v, want %v", got, want)
+			}
+
+			if h.pwc.Stats().LevelHits[c.level] == 0 {
+				t.Errorf("no lookup hit level %d", c.level)
+			}
+
+			if len(h.top.translationRsps()) != 2 {
+				t.Errorf("got %d responses, want 2", len(h.top.translationRsps()))
+			}
+		})
+	}
+}
+
+func TestPWCEntriesArePerProcess(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	h.translate(1, baseVAddr)
+	h.run()
+
+	h.translate(2, sameL2VAddr)
+	h.run()
+
+	if got := h.walkLatencies(); !reflect.DeepEqual(got, []int{400, 400}) {
+		t.Errorf("walk latencies = %v, want [400 400]", got)
+	}
+}
+
+func TestPWCMSHRMergesSameAddress(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+
+	req1 := h.translate(1, baseVAddr)
+	req2 := h.translate(1, baseVAddr)
+	h.run()
+
+	if len(h.low.received) != 1 {
+		t.Errorf("low module received %d walks, want 1", len(h.low.received))
+	}
+
+	rsps := h.top.translationRsps()
+	if len(rsps) != 2 {
+		t.Fatalf("got %d responses, want 2", len(rsps))
+	}
+
+	if rsps[0].RespondTo != req1.ID || rsps[1].RespondTo != req2.ID {
+		t.Errorf("responses are not in request order")
+	}
+
+	if len(h.pwc.mshr.AllEntries()) != 0 {
+		t.Errorf("MSHR still holds %d entries", len(h.pwc.mshr.AllEntries()))
+	}
+}
+
+func TestPWCStallsWhenMSHRIsFull(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().WithNumMSHREntry(2))
+
+	for i := uint64(0); i < 6; i++ {
+		h.translate(1, otherL4VAddr*i)
+	}
+	h.run()
+
+	if len(h.top.translationRsps()) != 6 {
+		t.Errorf("got %d responses, want 6", len(h.top.translationRsps()))
+	}
+}
+
+func TestPWCFlushAndRestart(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	h.translate(1, baseVAddr)
+	h.run()
+
+	h.control(FlushReqBuilder{}.
+		WithPID(1).
+		WithVAddrs([]uint64{baseVAddr}).
+		Build())
+	h.run()
+
+	if !h.pwc.isPaused {
+		t.Fatal("PWC is not paused after a flush")
+	}
+
+	h.translate(1, sameL2VAddr)
+	h.run()
+
+	if len(h.top.translationRsps()) != 1 {
+		t.Errorf("paused PWC responded to a request")
+	}
+
+	h.control(RestartReqBuilder{}.Build())
+	h.run()
+
+	if h.pwc.isPaused {
+		t.Fatal("PWC is still paused after a restart")
+	}
+
+	h.translate(1, sameL2VAddr)
+	h.run()
+
+	if got := h.walkLatencies(); !reflect.DeepEqual(got, []int{400, 400}) {
+		t.Errorf("walk latencies = %v, want [400 400]", got)
+	}
+
+	var flushRsps, restartRsps int
+	for _, msg := range h.ctrl.received {
+		switch msg.(type) {
+		case *FlushRsp:
+			flushRsps++
+		case *RestartRsp:
+			restartRsps++
+		}
+	}
+
+	if flushRsps != 1 || restartRsps != 1 {
+		t.Errorf("got %d flush and %d restart responses, want 1 and 1",
+			flushRsps, restartRsps)
+	}
+}
+
+func TestPWCFillsEachLevelOnce(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	h.translate(1, baseVAddr)
+	h.run()
+	h.translate(1, sameL2VAddr)
+	h.run()
+
+	stats := h.pwc.Stats()
+	for _, level := range cachedLevels {
+		if stats.Fills[level] != 1 || stats.FillsPresent[level] != 1 {
+			t.Errorf("level %d: %d fills and %d present, want 1 and 1",
+				level, stats.Fills[level], stats.FillsPresent[level])
+		}
+	}
+}
+
+func TestPWCRespondsThroughArrivalPort(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().WithTopPortBufferSizes(4, 4))
+
+	req := vm.TranslationReqBuilder{}.
+		WithSrc(h.top.port).
+		WithDst(h.pwc.topPorts[1]).
+		WithPID(1).
+		WithVAddr(baseVAddr).
+		Build()
+	h.top.send(req)
+	h.run()
+
+	rsps := h.top.translationRsps()
+	if len(rsps) != 1 || rsps[0].Src != h.pwc.topPorts[1] {
+		t.Errorf("response did not come from the port the request used")
+	}
+}
+
+func TestPWCLookupModes(t *testing.T) {
+	cases := []struct {
+		name    string
+		mode    LookupMode
+		latency int
+	}{
+		{"ideal", LookupIdeal, 100},
+		{"disabled", LookupDisabled, 400},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			h := newPWCHarness(t, MakeBuilder().WithLookupMode(c.mode))
+			h.translate(1, baseVAddr)
+			h.run()
+			h.translate(1, sameL3VAddr)
+			h.run()
+
+			want := []int{c.latency, c.latency}
+			if got := h.walkLatencies(); !reflect.DeepEqual(got, want) {
+				t.Errorf("walk latencies = %v, want %v", got, want)
+			}
+
+			hits := h.pwc.Stats().LevelHits
+			if hits[LevelNone] != 1 || hits[LevelL3] != 1 {
+				t.Errorf("level hits = %v, want the levels found in the sets",
+					hits)
+			}
+
+			if len(h.top.translationRsps()) != 2 {
+				t.Errorf("got %d responses, want 2", len(h.top.translationRsps()))
+			}
+		})
+	}
+}
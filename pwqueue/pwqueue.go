@@ -69,6 +69,11 @@ func (q *PWQueue) Remove(PID vm.PID, VA uint64) error {
 	return errors.New("element not found")
 }
 
+// Reset 清空队列
+func (q *PWQueue) Reset() {
+	q.elements = nil
+}
+
 // IsEmpty 检查队列是否为空
 func (q *PWQueue) IsEmpty() bool {
 	return len(q.elements) == 0
@@ -0,0 +1,56 @@
+package pwqueue
+
+import (
+	"testing"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+func TestPWQueueEnqueueRemove(t *testing.T) {
+	q := NewPWQueue(2)
+	req1 := &vm.TranslationReq{PID: 1, VAddr: 0x1000}
+	req2 := &vm.TranslationReq{PID: 1, VAddr: 0x2000}
+
+	if err := q.Enqueue(Newpwqueueentry(req1, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Enqueue(Newpwqueueentry(req2, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Enqueue(Newpwqueueentry(req1, 0)); err == nil {
+		t.Error("enqueue into a full queue succeeded")
+	}
+
+	if err := q.Remove(1, 0x1000); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := q.Index(0)
+	if err != nil || e.Req != req2 {
+		t.Errorf("head is not the remaining entry")
+	}
+
+	if err := q.Remove(1, 0x1000); err == nil {
+		t.Error("removing a missing entry succeeded")
+	}
+}
+
+func TestPWQueueUpdatehitl(t *testing.T) {
+	q := NewPWQueue(1)
+	q.Enqueue(Newpwqueueentry(&vm.TranslationReq{}, 0))
+
+	if err := q.Updatehitl(0, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	e, _ := q.Index(0)
+	if e.Hitlevel != 3 {
+		t.Errorf("hit level = %d, want 3", e.Hitlevel)
+	}
+
+	if err := q.Updatehitl(1, 3); err == nil {
+		t.Error("updating an out-of-range entry succeeded")
+	}
+}
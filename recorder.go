@@ -0,0 +1,191 @@
+package pwcache
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+// A TraceRecord describes a translation request that arrived at a top port of
+// a PWC. HitLevel is the level at which the lookup of the walk that served
+// the request hit, and is empty, as is CompletionTime, if the request was
+// never answered.
+type TraceRecord struct {
+	Time           sim.VTimeInSec  `json:"time"`
+	PID            vm.PID          `json:"pid"`
+	VAddr          uint64          `json:"vaddr"`
+	DeviceID       uint64          `json:"device_id"`
+	MSHRHit        bool            `json:"mshr_hit"`
+	HitLevel       string          `json:"hit_level,omitempty"`
+	CompletionTime *sim.VTimeInSec `json:"completion_time,omitempty"`
+}
+
+// A Recorder writes a TraceRecord per line for every request that a PWC
+// receives. The records follow the order in which MSHRlookup takes the
+// requests, which is the order of the lookups and of an Oracle read from the
+// trace. Under arbitration, it differs from the order of arrival at the top
+// ports that the Time fields give. Requests discarded by a restart are
+// recorded where they are discarded.
+//
+// A record is written once its request and all the requests taken before it
+// are answered or dropped. Once more than maxPendingRecords records wait, the
+// oldest is written without its outcome, so that a request that is never
+// answered does not hold back the whole trace. The Recorder is a
+// SimulationEndHandler that writes the remaining records and flushes when the
+// engine finishes.
+type Recorder struct {
+	w      *bufio.Writer
+	enc    *json.Encoder
+	closer io.Closer
+
+	maxPending int
+	queue      []*pendingRecord
+	pending    map[string]*pendingRecord
+	err        error
+}
+
+// maxPendingRecords is the number of records that a Recorder holds back.
+const maxPendingRecords = 1 << 16
+
+type pendingRecord struct {
+	TraceRecord
+	id   string
+	done bool
+}
+
+// NewRecorder returns a Recorder that writes to w.
+func NewRecorder(w io.Writer) *Recorder {
+	r := &Recorder{
+		w:          bufio.NewWriter(w),
+		maxPending: maxPendingRecords,
+		pending:    make(map[string]*pendingRecord),
+	}
+	r.enc = json.NewEncoder(r.w)
+
+	return r
+}
+
+// CreateRecorder returns a Recorder that writes to a new file at path. The
+// file is closed when the Recorder is.
+func CreateRecorder(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := NewRecorder(f)
+	r.closer = f
+
+	return r, nil
+}
+
+// Handle closes the Recorder at the end of the simulation.
+func (r *Recorder) Handle(now sim.VTimeInSec) {
+	if err := r.Close(); err != nil {
+		log.Panicf("cannot write PWC trace: %v", err)
+	}
+}
+
+// Close writes the records of the requests that are still in flight and
+// flushes the output. It returns the first error met while writing.
+func (r *Recorder) Close() error {
+	for _, p := range r.queue {
+		r.write(p)
+	}
+	r.queue = nil
+	r.pending = make(map[string]*pendingRecord)
+
+	if err := r.w.Flush(); err != nil && r.err == nil {
+		r.err = err
+	}
+
+	if r.closer != nil {
+		if err := r.closer.Close(); err != nil && r.err == nil {
+			r.err = err
+		}
+		r.closer = nil
+	}
+
+	return r.err
+}
+
+// arrive starts the record of a request that MSHRlookup takes from the top
+// ports.
+func (r *Recorder) arrive(req *vm.TranslationReq, mshrHit bool) {
+	p := &pendingRecord{
+		TraceRecord: TraceRecord{
+			Time:     req.RecvTime,
+			PID:      req.PID,
+			VAddr:    req.VAddr,
+			DeviceID: req.DeviceID,
+			MSHRHit:  mshrHit,
+		},
+		id: req.ID,
+	}
+
+	r.queue = append(r.queue, p)
+	r.pending[req.ID] = p
+
+	for len(r.queue) > r.maxPending {
+		delete(r.pending, r.queue[0].id)
+		r.write(r.queue[0])
+		r.queue = r.queue[1:]
+		r.writeDone()
+	}
+}
+
+// complete finishes the record of a request whose response has been sent.
+func (r *Recorder) complete(
+	now sim.VTimeInSec,
+	req *vm.TranslationReq,
+	hitlevel int,
+) {
+	p, found := r.pending[req.ID]
+	if !found {
+		return
+	}
+
+	p.HitLevel = levelNames[hitlevel]
+	p.CompletionTime = &now
+	r.finish(req)
+}
+
+// drop finishes the record of a request that will never be answered.
+func (r *Recorder) drop(req *vm.TranslationReq) {
+	if _, found := r.pending[req.ID]; found {
+		r.finish(req)
+	}
+}
+
+// discard records a request that is thrown away before MSHRlookup takes it.
+func (r *Recorder) discard(req *vm.TranslationReq) {
+	r.arrive(req, false)
+	r.drop(req)
+}
+
+func (r *Recorder) finish(req *vm.TranslationReq) {
+	r.pending[req.ID].done = true
+	delete(r.pending, req.ID)
+	r.writeDone()
+}
+
+// writeDone writes the finished records at the head of the queue.
+func (r *Recorder) writeDone() {
+	for len(r.queue) > 0 && r.queue[0].done {
+		r.write(r.queue[0])
+		r.queue = r.queue[1:]
+	}
+}
+
+func (r *Recorder) write(p *pendingRecord) {
+	if r.err != nil {
+		return
+	}
+
+	r.err = r.enc.Encode(p.TraceRecord)
+}
@@ -0,0 +1,157 @@
+package pwcache
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+func decodeRecords(t *testing.T, data string) []TraceRecord {
+	var records []TraceRecord
+	for _, line := range strings.Split(strings.TrimSpace(data), "\n") {
+		var rec TraceRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("cannot decode %q: %v", line, err)
+		}
+
+		records = append(records, rec)
+	}
+
+	return records
+}
+
+func TestRecorderWritesRequestsInArrivalOrder(t *testing.T) {
+	var buf bytes.Buffer
+	h := newPWCHarness(t, MakeBuilder().WithRecorder(NewRecorder(&buf)))
+
+	h.translate(1, baseVAddr)
+	h.translate(1, baseVAddr)
+	h.run()
+	h.translate(1, sameL3VAddr)
+	h.run()
+
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes before the simulation finished", buf.Len())
+	}
+
+	h.engine.Finished()
+
+	records := decodeRecords(t, buf.String())
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3:\n%s", len(records), buf.String())
+	}
+
+	want := []struct {
+		vAddr    uint64
+		mshrHit  bool
+		hitLevel string
+	}{
+		{baseVAddr, false, "miss"},
+		{baseVAddr, true, "miss"},
+		{sameL3VAddr, false, "l3"},
+	}
+	for i, w := range want {
+		rec := records[i]
+		if rec.PID != 1 || rec.VAddr != w.vAddr || rec.MSHRHit != w.mshrHit ||
+			rec.HitLevel != w.hitLevel {
+			t.Errorf("record %d = %+v, want VAddr 0x%x, MSHR hit %v, level %s",
+				i, rec, w.vAddr, w.mshrHit, w.hitLevel)
+		}
+
+		if rec.CompletionTime == nil || *rec.CompletionTime <= rec.Time {
+			t.Errorf("record %d completes at %v, arrived at %v",
+				i, rec.CompletionTime, rec.Time)
+		}
+	}
+}
+
+func TestRecorderWaitsForEarlierRequests(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+
+	first := vm.TranslationReqBuilder{}.WithPID(1).WithVAddr(0x1000).Build()
+	second := vm.TranslationReqBuilder{}.WithPID(1).WithVAddr(0x2000).Build()
+	r.arrive(first, false)
+	r.arrive(second, false)
+	r.complete(1, second, LevelL2)
+	if err := r.w.Flush(); err != nil || buf.Len() != 0 {
+		t.Fatalf("wrote %q before the first request completed", buf.String())
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := decodeRecords(t, buf.String())
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+
+	if records[0].VAddr != 0x1000 || records[0].CompletionTime != nil ||
+		records[0].HitLevel != "" {
+		t.Errorf("first record = %+v, want one without completion", records[0])
+	}
+
+	if records[1].VAddr != 0x2000 || records[1].HitLevel != "l2" {
+		t.Errorf("second record = %+v, want an l2 hit", records[1])
+	}
+}
+
+func TestRecorderRecordsRequestsDiscardedByRestart(t *testing.T) {
+	var buf bytes.Buffer
+	h := newPWCHarness(t, MakeBuilder().
+		WithArbitrationPolicy(ArbitrationRoundRobin).
+		WithRecorder(NewRecorder(&buf)))
+
+	h.control(FlushReqBuilder{}.WithPID(1).Build())
+	h.run()
+	h.translate(1, baseVAddr)
+	h.run()
+	h.pwc.arbiter.accept(vm.TranslationReqBuilder{}.
+		WithPID(1).
+		WithVAddr(sameL2VAddr).
+		Build())
+
+	h.control(RestartReqBuilder{}.Build())
+	h.run()
+	h.engine.Finished()
+
+	records := decodeRecords(t, buf.String())
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2:\n%s", len(records), buf.String())
+	}
+
+	for i, rec := range records {
+		if rec.CompletionTime != nil || rec.HitLevel != "" {
+			t.Errorf("record %d = %+v, want one without completion", i, rec)
+		}
+	}
+}
+
+func TestRecorderBoundsHeldRecords(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRecorder(&buf)
+	r.maxPending = 2
+
+	for i := uint64(1); i <= 3; i++ {
+		r.arrive(vm.TranslationReqBuilder{}.WithPID(1).WithVAddr(i<<12).Build(),
+			false)
+	}
+
+	if err := r.w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := decodeRecords(t, buf.String())
+	if len(records) != 1 || records[0].VAddr != 1<<12 {
+		t.Errorf("records = %+v, want only the oldest", records)
+	}
+
+	if len(r.queue) != 2 || len(r.pending) != 2 {
+		t.Errorf("holds %d records, %d pending, want 2 and 2",
+			len(r.queue), len(r.pending))
+	}
+}
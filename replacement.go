@@ -0,0 +1,195 @@
+package pwcache
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"sort"
+)
+
+// ReplacementPolicy selects the way that a fill evicts among the ways that
+// the partition and the device quota allow.
+type ReplacementPolicy int
+
+// Replacement policies supported by the PWC.
+const (
+	// ReplacementLRU evicts the least recently visited way.
+	ReplacementLRU ReplacementPolicy = iota
+
+	// ReplacementOPT evicts the entry whose next use is the furthest in the
+	// future, as known from an Oracle. The future of a fill starts after the
+	// request whose walk discovered the entry, so the lookups that were taken
+	// while the walk was in flight still count as uses. WarmUp does not move
+	// through the Oracle, so the fills of the warm-up are judged by the uses
+	// of the timed requests.
+	ReplacementOPT
+
+	// ReplacementBIP evicts like LRU but inserts most entries as the least
+	// recently visited, so that a scan over many prefixes does not flush the
+	// entries that are reused. Only one fill in bipThrottle is inserted as
+	// the most recently visited.
+	ReplacementBIP
+
+	// ReplacementDueling dedicates leader sets to LRU and to BIP and lets the
+	// other sets follow the one whose leaders miss less. It needs at least
+	// three sets, so that one of them follows.
+	ReplacementDueling
+
+	// ReplacementCostAware evicts the entry with the lowest product of its
+	// recency rank, counted from 1 at the least recently visited way, and
+	// the cost weight of its level, so that the entries that save more walk
+	// cycles stay longer.
+	ReplacementCostAware
+)
+
+// An Oracle holds the sequence of translations that a PWC will receive, in
+// the order in which they arrive at its top ports.
+type Oracle struct {
+	accesses []Access
+}
+
+// NewOracle returns an Oracle of the accesses.
+func NewOracle(accesses []Access) *Oracle {
+	return &Oracle{accesses: append([]Access(nil), accesses...)}
+}
+
+// ReadOracle returns an Oracle of the requests of a JSON-lines trace, such as
+// the one written by a Recorder. Only the pid and the vaddr of each line are
+// used.
+func ReadOracle(r io.Reader) (*Oracle, error) {
+	o := &Oracle{}
+	dec := json.NewDecoder(r)
+	for {
+		var rec TraceRecord
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			return o, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		o.accesses = append(o.accesses, Access{PID: rec.PID, VAddr: rec.VAddr})
+	}
+}
+
+// LoadOracle returns an Oracle of the JSON-lines trace at path.
+func LoadOracle(path string) (*Oracle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadOracle(f)
+}
+
+// futureUses tells when each entry is used next. Every request that
+// MSHRlookup takes is numbered with its position in the Oracle, and the
+// fills of a walk look for the uses after the request that started it.
+type futureUses struct {
+	numArrived int
+	pos        int
+	uses       map[reuseKey][]int
+}
+
+func newFutureUses(o *Oracle, pwc *PWC) *futureUses {
+	f := &futureUses{uses: make(map[reuseKey][]int)}
+	for i, a := range o.accesses {
+		for _, level := range cachedLevels {
+			key := reuseKey{
+				pid:    a.PID,
+				prefix: pwc.prefix(a.VAddr, level),
+				level:  level,
+			}
+			f.uses[key] = append(f.uses[key], i)
+		}
+	}
+
+	return f
+}
+
+// arrive numbers the request that MSHRlookup has just taken.
+func (f *futureUses) arrive() {
+	f.numArrived++
+}
+
+// nextUse returns the position of the next access at or after pos that needs
+// the entry, or math.MaxInt if there is none.
+func (f *futureUses) nextUse(key reuseKey) int {
+	uses := f.uses[key]
+	i := sort.SearchInts(uses, f.pos)
+	if i == len(uses) {
+		return math.MaxInt
+	}
+
+	return uses[i]
+}
+
+// evictOPT evicts the way that canEvict accepts whose entry is used next the
+// furthest in the future. Empty and invalid ways are never used again.
+func (pwc *PWC) evictOPT(
+	set Set,
+	canEvict func(wayID int) bool,
+) (wayID int, ok bool) {
+	victim, furthest := -1, -1
+	for w := 0; w < pwc.numWays; w++ {
+		if set.IsPinned(w) || !canEvict(w) {
+			continue
+		}
+
+		next := math.MaxInt
+		page := set.Page(w)
+		if level := set.Level(w); level != LevelNone && page.Valid {
+			next = pwc.future.nextUse(reuseKey{
+				pid:    page.PID,
+				prefix: page.VAddr,
+				level:  level,
+			})
+		}
+
+		if next > furthest {
+			victim, furthest = w, next
+		}
+	}
+
+	if victim < 0 {
+		return 0, false
+	}
+
+	return set.EvictIf(func(wayID int) bool { return wayID == victim })
+}
+
+// evictCostAware evicts the way that canEvict accepts with the lowest
+// product of recency rank and level cost weight. Empty and invalid ways are
+// evicted first. Ties go to the least recently visited way.
+func (pwc *PWC) evictCostAware(
+	set Set,
+	canEvict func(wayID int) bool,
+) (wayID int, ok bool) {
+	victim, lowest := -1, math.MaxInt
+	for rank, w := range set.VisitOrder() {
+		if set.IsPinned(w) || !canEvict(w) {
+			continue
+		}
+
+		level := set.Level(w)
+		if level == LevelNone || !set.Page(w).Valid {
+			victim = w
+			break
+		}
+
+		if score := (rank + 1) * pwc.costWeights[level]; score < lowest {
+			victim, lowest = w, score
+		}
+	}
+
+	if victim < 0 {
+		return 0, false
+	}
+
+	return set.EvictIf(func(wayID int) bool { return wayID == victim })
+}
@@ -0,0 +1,133 @@
+package pwcache
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadOracleKeepsPIDAndVAddr(t *testing.T) {
+	trace := `{"time": 0, "pid": 1, "vaddr": 4096, "mshr_hit": false}
+{"time": 1e-9, "pid": 2, "vaddr": 8192, "mshr_hit": true, "hit_level": "l2"}
+`
+	o, err := ReadOracle(strings.NewReader(trace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Access{{PID: 1, VAddr: 4096}, {PID: 2, VAddr: 8192}}
+	if !reflect.DeepEqual(o.accesses, want) {
+		t.Errorf("accesses = %v, want %v", o.accesses, want)
+	}
+}
+
+func TestOPTEvictsTheEntryReusedFurthest(t *testing.T) {
+	nextL3VAddr := sameL3VAddr + 1<<21
+	sequence := []uint64{baseVAddr, sameL3VAddr, nextL3VAddr, baseVAddr}
+
+	oracle := make([]Access, len(sequence))
+	for i, vAddr := range sequence {
+		oracle[i] = Access{PID: 1, VAddr: vAddr}
+	}
+
+	for _, tc := range []struct {
+		policy ReplacementPolicy
+		l2Hits uint64
+	}{
+		{ReplacementLRU, 0},
+		{ReplacementOPT, 1},
+	} {
+		h := newPWCHarness(t, MakeBuilder().
+			WithNumWays(4).
+			WithReplacementPolicy(tc.policy).
+			WithOracle(NewOracle(oracle)))
+		for _, vAddr := range sequence {
+			h.translate(1, vAddr)
+			h.run()
+		}
+
+		if got := h.pwc.Stats().LevelHits[LevelL2]; got != tc.l2Hits {
+			t.Errorf("%v: L2 hits = %d, want %d", tc.policy, got, tc.l2Hits)
+		}
+	}
+}
+
+func TestOPTHitsAtLeastAsOftenAsLRUWithWalksInFlight(t *testing.T) {
+	var sequence []uint64
+	for round := 0; round < 4; round++ {
+		for i := uint64(0); i < 4; i++ {
+			sequence = append(sequence,
+				baseVAddr+i<<21, otherL4VAddr+i<<21)
+		}
+	}
+
+	oracle := make([]Access, len(sequence))
+	for i, vAddr := range sequence {
+		oracle[i] = Access{PID: 1, VAddr: vAddr}
+	}
+
+	hits := make(map[ReplacementPolicy]uint64)
+	for _, policy := range []ReplacementPolicy{
+		ReplacementLRU, ReplacementOPT,
+	} {
+		h := newPWCHarness(t, MakeBuilder().
+			WithNumWays(8).
+			WithReplacementPolicy(policy).
+			WithOracle(NewOracle(oracle)))
+		for i := 0; i < len(sequence); i += 2 {
+			h.translate(1, sequence[i])
+			h.translate(1, sequence[i+1])
+			h.run()
+		}
+
+		hits[policy] = h.pwc.Stats().LevelHits[LevelL2]
+	}
+
+	if hits[ReplacementOPT] < hits[ReplacementLRU] {
+		t.Errorf("OPT hit L2 %d times, LRU %d, want OPT to hit at least as often",
+			hits[ReplacementOPT], hits[ReplacementLRU])
+	}
+}
+
+func TestCostAwareWeighsRecencyByLevel(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		b    Builder
+		want int
+	}{
+		{"default weights", MakeBuilder(), LevelL2},
+		{"cheap L4", MakeBuilder().WithCostWeights(1, 4, 4), LevelL4},
+	} {
+		h := newPWCHarness(t, tc.b.
+			WithNumWays(3).
+			WithReplacementPolicy(ReplacementCostAware))
+		set := h.pwc.Sets[0]
+		fillSet(set, 1, 0x200000, LevelL2)
+		fillSet(set, 1, 0, LevelL4)
+		fillSet(set, 1, 0x40000000, LevelL3)
+
+		wayID, ok := h.pwc.evict(set, LevelL2, 0)
+		if !ok || set.Level(wayID) != tc.want {
+			t.Errorf("%s: evicted a level %d entry, want level %d",
+				tc.name, set.Level(wayID), tc.want)
+		}
+	}
+}
+
+func TestDefaultCostWeightsRankUpperLevelsFirst(t *testing.T) {
+	pwc := buildableBuilder().Build("PWC")
+	w := pwc.costWeights
+	if !(w[LevelL4] > w[LevelL3] && w[LevelL3] > w[LevelL2] && w[LevelL2] > 0) {
+		t.Errorf("default weights L4 %d, L3 %d, L2 %d are not decreasing",
+			w[LevelL4], w[LevelL3], w[LevelL2])
+	}
+
+	b, err := buildableBuilder().WithConfig(MakeBuilder().Config())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := b.Build("PWC").costWeights; got != w {
+		t.Errorf("weights after a config round trip = %v, want %v", got, w)
+	}
+}
@@ -0,0 +1,208 @@
+package pwcache
+
+import (
+	"sort"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+// A ReuseHistogram counts accesses to entries by stack reuse distance, which
+// is the number of distinct entries accessed since the previous access to the
+// same entry.
+type ReuseHistogram struct {
+	// Distances[d] counts the accesses at distance d.
+	Distances []uint64
+
+	// Cold counts the first accesses to entries.
+	Cold uint64
+}
+
+// Accesses returns the number of accesses counted.
+func (h ReuseHistogram) Accesses() uint64 {
+	n := h.Cold
+	for _, c := range h.Distances {
+		n += c
+	}
+
+	return n
+}
+
+// HitRate predicts the fraction of the accesses that hit in a
+// fully-associative LRU cache of numEntries entries.
+func (h ReuseHistogram) HitRate(numEntries int) float64 {
+	total := h.Accesses()
+	if total == 0 {
+		return 0
+	}
+
+	var hits uint64
+	for d := 0; d < numEntries && d < len(h.Distances); d++ {
+		hits += h.Distances[d]
+	}
+
+	return float64(hits) / float64(total)
+}
+
+func (h *ReuseHistogram) add(distance int) {
+	for len(h.Distances) <= distance {
+		h.Distances = append(h.Distances, 0)
+	}
+
+	h.Distances[distance]++
+}
+
+func (h ReuseHistogram) clone() ReuseHistogram {
+	h.Distances = append([]uint64(nil), h.Distances...)
+	return h
+}
+
+// ReuseHistograms holds a ReuseHistogram per level. The LevelNone slot is
+// unused.
+type ReuseHistograms [numLevels]ReuseHistogram
+
+func (hs ReuseHistograms) clone() ReuseHistograms {
+	for i := range hs {
+		hs[i] = hs[i].clone()
+	}
+
+	return hs
+}
+
+// A ReuseProfile holds the reuse distances of the prefixes of every level
+// that the lookups access, for all the processes and for each one. Each
+// lookup accesses the L4, L3, and L2 prefixes of its address, in the order in
+// which the walk fills them. The distances are measured in a single stack
+// shared by all the levels and processes, as they share the PWC, so that
+// Levels[level].HitRate(n) predicts the hit rate of the level in a
+// fully-associative PWC of n entries.
+type ReuseProfile struct {
+	Levels ReuseHistograms
+	PerPID map[vm.PID]ReuseHistograms
+}
+
+// ReuseProfile returns a copy of the reuse distances profiled so far. It is
+// empty unless the PWC was built with reuse profiling.
+func (pwc *PWC) ReuseProfile() ReuseProfile {
+	rp := ReuseProfile{PerPID: make(map[vm.PID]ReuseHistograms)}
+	if pwc.reuseProfiler == nil {
+		return rp
+	}
+
+	rp.Levels = pwc.reuseProfiler.levels.clone()
+	for pid, hs := range pwc.reuseProfiler.perPID {
+		rp.PerPID[pid] = hs.clone()
+	}
+
+	return rp
+}
+
+// reuseProfiler measures stack distances with a Fenwick tree over the times of
+// the accesses, in which only the latest access to each entry is marked. The
+// distance of an access is the number of marks after the previous access to
+// its entry. The times are renumbered when the tree is full, so that its size
+// follows the number of distinct entries rather than the number of accesses.
+type reuseProfiler struct {
+	last map[reuseKey]int
+	tree []int
+	now  int
+
+	levels ReuseHistograms
+	perPID map[vm.PID]*ReuseHistograms
+}
+
+const minReuseTreeSize = 1024
+
+func newReuseProfiler() *reuseProfiler {
+	return &reuseProfiler{
+		last:   make(map[reuseKey]int),
+		tree:   make([]int, minReuseTreeSize+1),
+		perPID: make(map[vm.PID]*ReuseHistograms),
+	}
+}
+
+// access records an access to the entry.
+func (p *reuseProfiler) access(key reuseKey) {
+	hs := p.perPID[key.pid]
+	if hs == nil {
+		hs = &ReuseHistograms{}
+		p.perPID[key.pid] = hs
+	}
+
+	t, seen := p.last[key]
+	if seen {
+		distance := p.sum(p.now) - p.sum(t)
+		p.levels[key.level].add(distance)
+		hs[key.level].add(distance)
+		p.mark(t, -1)
+		delete(p.last, key)
+	} else {
+		p.levels[key.level].Cold++
+		hs[key.level].Cold++
+	}
+
+	if p.now == len(p.tree)-1 {
+		p.renumber()
+	}
+
+	p.now++
+	p.mark(p.now, 1)
+	p.last[key] = p.now
+}
+
+// renumber gives the latest accesses to the entries consecutive times and
+// resizes the tree to twice their number.
+func (p *reuseProfiler) renumber() {
+	keys := make([]reuseKey, 0, len(p.last))
+	for key := range p.last {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return p.last[keys[i]] < p.last[keys[j]]
+	})
+
+	p.tree = make([]int, max(2*len(keys), minReuseTreeSize)+1)
+	p.now = 0
+	for _, key := range keys {
+		p.now++
+		p.mark(p.now, 1)
+		p.last[key] = p.now
+	}
+}
+
+func (p *reuseProfiler) mark(t, delta int) {
+	for ; t < len(p.tree); t += t & -t {
+		p.tree[t] += delta
+	}
+}
+
+// sum returns the number of marks at or before t.
+func (p *reuseProfiler) sum(t int) int {
+	n := 0
+	for ; t > 0; t -= t & -t {
+		n += p.tree[t]
+	}
+
+	return n
+}
+
+// reset clears the histograms and keeps the stack.
+func (p *reuseProfiler) reset() {
+	p.levels = ReuseHistograms{}
+	p.perPID = make(map[vm.PID]*ReuseHistograms)
+}
+
+// profileReuse records the accesses of a lookup of vAddr to the prefixes of
+// every level.
+func (pwc *PWC) profileReuse(pid vm.PID, vAddr uint64) {
+	if pwc.reuseProfiler == nil {
+		return
+	}
+
+	for _, level := range fillLevels {
+		pwc.reuseProfiler.access(reuseKey{
+			pid:    pid,
+			prefix: pwc.prefix(vAddr, level),
+			level:  level,
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package pwcache
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func TestReuseProfilerMatchesLRUStack(t *testing.T) {
+	p := newReuseProfiler()
+	var want ReuseHistogram
+	var stack []reuseKey
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		key := reuseKey{pid: 1, prefix: uint64(r.Intn(50)), level: LevelL2}
+		p.access(key)
+
+		found := false
+		for d := len(stack) - 1; d >= 0; d-- {
+			if stack[d] == key {
+				want.add(len(stack) - 1 - d)
+				stack = append(stack[:d], stack[d+1:]...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			want.Cold++
+		}
+		stack = append(stack, key)
+	}
+
+	if !reflect.DeepEqual(p.levels[LevelL2], want) {
+		t.Errorf("histogram = %+v, want %+v", p.levels[LevelL2], want)
+	}
+}
+
+func TestPWCProfilesReuseOfLookups(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().WithReuseProfiling(true))
+	h.translate(1, baseVAddr)
+	h.run()
+	h.translate(1, sameL3VAddr)
+	h.run()
+	h.translate(1, sameL2VAddr)
+	h.run()
+
+	l2 := h.pwc.ReuseProfile().PerPID[1][LevelL2]
+	want := ReuseHistogram{Distances: []uint64{0, 0, 0, 1}, Cold: 2}
+	if !reflect.DeepEqual(l2, want) {
+		t.Errorf("L2 histogram = %+v, want %+v", l2, want)
+	}
+
+	if got := l2.HitRate(4); got != 1.0/3 {
+		t.Errorf("hit rate of 4 entries = %v, want 1/3", got)
+	}
+
+	if got := l2.HitRate(3); got != 0 {
+		t.Errorf("hit rate of 3 entries = %v, want 0", got)
+	}
+}
@@ -10,10 +10,22 @@ import (
 
 // A Set holds a certain number of pages.
 type Set interface {
-	Lookup(pid vm.PID, vAddr uint64) (wayID int, page vm.Page, found bool)
-	Update(wayID int, page vm.Page)
+	Lookup(pid vm.PID, vAddr uint64, level int) (
+		wayID int, page vm.Page, found bool)
+	Page(wayID int) vm.Page
+	Update(wayID int, page vm.Page, level int)
 	Evict() (wayID int, ok bool)
+	EvictIf(canEvict func(wayID int) bool) (wayID int, ok bool)
 	Visit(wayID int)
+	Demote(wayID int)
+	VisitOrder() []int
+	Level(wayID int) int
+	Owner(wayID int) uint64
+	SetOwner(wayID int, owner uint64)
+	Pin(wayID int)
+	Unpin(wayID int)
+	IsPinned(wayID int) bool
+	NumPinned() int
 }
 
 // NewSet creates a new TLB set.
@@ -34,6 +46,9 @@ func NewSet(numWays int) Set {
 type block struct {
 	page      vm.Page
 	wayID     int
+	level     int
+	owner     uint64
+	pinned    bool
 	lastVisit uint64
 }
 
@@ -43,21 +58,24 @@ func (b *block) Less(anotherBlock *block) bool {
 
 type setImpl struct {
 	blocks        []*block
+	numPinned     int
 	vAddrWayIDMap map[string]int
 	visitList     []*block
 	visitCount    uint64
 }
 
-func (s *setImpl) keyString(pid vm.PID, vAddr uint64) string {
-	return fmt.Sprintf("%d%016x", pid, vAddr)
+// keyString identifies an entry. The level is part of the key because the
+// prefixes of different levels can be numerically equal.
+func (s *setImpl) keyString(pid vm.PID, vAddr uint64, level int) string {
+	return fmt.Sprintf("%d%016x%d", pid, vAddr, level)
 }
 
-func (s *setImpl) Lookup(pid vm.PID, vAddr uint64) (
+func (s *setImpl) Lookup(pid vm.PID, vAddr uint64, level int) (
 	wayID int,
 	page vm.Page,
 	found bool,
 ) {
-	key := s.keyString(pid, vAddr)
+	key := s.keyString(pid, vAddr, level)
 	wayID, ok := s.vAddrWayIDMap[key]
 	if !ok {
 		return 0, vm.Page{}, false
@@ -68,13 +86,21 @@ func (s *setImpl) Lookup(pid vm.PID, vAddr uint64) (
 	return block.wayID, block.page, true
 }
 
-func (s *setImpl) Update(wayID int, page vm.Page) {
+// Page returns the entry held by the way.
+func (s *setImpl) Page(wayID int) vm.Page {
+	return s.blocks[wayID].page
+}
+
+func (s *setImpl) Update(wayID int, page vm.Page, level int) {
 	block := s.blocks[wayID]
-	key := s.keyString(block.page.PID, block.page.VAddr)
-	delete(s.vAddrWayIDMap, key)
+	key := s.keyString(block.page.PID, block.page.VAddr, block.level)
+	if s.vAddrWayIDMap[key] == wayID {
+		delete(s.vAddrWayIDMap, key)
+	}
 
 	block.page = page
-	key = s.keyString(page.PID, page.VAddr)
+	block.level = level
+	key = s.keyString(page.PID, page.VAddr, level)
 	s.vAddrWayIDMap[key] = wayID
 }
 
@@ -83,11 +109,20 @@ func (s *setImpl) Evict() (wayID int, ok bool) {
 		return 0, false
 	}
 
-	// wayID = s.visitTree.DeleteMin().(*block).wayID
-	leastVisited := s.visitList[0]
-	wayID = leastVisited.wayID
-	s.visitList = s.visitList[1:]
-	return wayID, true
+	return s.EvictIf(func(int) bool { return true })
+}
+
+// EvictIf evicts the least recently visited way that canEvict accepts. Pinned
+// ways are never evicted.
+func (s *setImpl) EvictIf(canEvict func(wayID int) bool) (wayID int, ok bool) {
+	for i, b := range s.visitList {
+		if !b.pinned && canEvict(b.wayID) {
+			s.visitList = append(s.visitList[:i], s.visitList[i+1:]...)
+			return b.wayID, true
+		}
+	}
+
+	return 0, false
 }
 
 func (s *setImpl) Visit(wayID int) {
@@ -111,6 +146,77 @@ func (s *setImpl) Visit(wayID int) {
 	s.visitList[index] = block
 }
 
+// Demote makes the way the least recently visited one, so that it is evicted
+// first unless visited again.
+func (s *setImpl) Demote(wayID int) {
+	demoted := s.blocks[wayID]
+
+	for i, b := range s.visitList {
+		if b.wayID == wayID {
+			s.visitList = append(s.visitList[:i], s.visitList[i+1:]...)
+			break
+		}
+	}
+
+	demoted.lastVisit = 0
+	s.visitList = append([]*block{demoted}, s.visitList...)
+}
+
+// VisitOrder returns the IDs of the ways from the least to the most recently
+// visited.
+func (s *setImpl) VisitOrder() []int {
+	order := make([]int, len(s.visitList))
+	for i, b := range s.visitList {
+		order[i] = b.wayID
+	}
+
+	return order
+}
+
+// Level returns the page-table level of the entry held by the way. Ways that
+// have never been filled report LevelNone.
+func (s *setImpl) Level(wayID int) int {
+	return s.blocks[wayID].level
+}
+
+// Owner returns the ID of the device whose walk filled the way.
+func (s *setImpl) Owner(wayID int) uint64 {
+	return s.blocks[wayID].owner
+}
+
+// SetOwner records the ID of the device whose walk filled the way.
+func (s *setImpl) SetOwner(wayID int, owner uint64) {
+	s.blocks[wayID].owner = owner
+}
+
+// Pin protects the way from eviction.
+func (s *setImpl) Pin(wayID int) {
+	block := s.blocks[wayID]
+	if !block.pinned {
+		block.pinned = true
+		s.numPinned++
+	}
+}
+
+// Unpin makes the way evictable again.
+func (s *setImpl) Unpin(wayID int) {
+	block := s.blocks[wayID]
+	if block.pinned {
+		block.pinned = false
+		s.numPinned--
+	}
+}
+
+// IsPinned checks if the way is protected from eviction.
+func (s *setImpl) IsPinned(wayID int) bool {
+	return s.blocks[wayID].pinned
+}
+
+// NumPinned returns the number of pinned ways in the set.
+func (s *setImpl) NumPinned() int {
+	return s.numPinned
+}
+
 func (s *setImpl) hasNothingToEvict() bool {
 	return len(s.visitList) == 0
 }
@@ -0,0 +1,78 @@
+package pwcache
+
+import (
+	"testing"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+func fillSet(set Set, pid vm.PID, vAddr uint64, level int) int {
+	wayID, ok := set.Evict()
+	if !ok {
+		panic("failed to evict")
+	}
+
+	set.Update(wayID, vm.Page{PID: pid, VAddr: vAddr, Valid: true}, level)
+	set.Visit(wayID)
+
+	return wayID
+}
+
+func TestSetEvictsLeastRecentlyVisited(t *testing.T) {
+	set := NewSet(2)
+	way0 := fillSet(set, 1, 0x1000, LevelL2)
+	fillSet(set, 1, 0x2000, LevelL2)
+	set.Visit(way0)
+
+	wayID, ok := set.Evict()
+	if !ok || wayID == way0 {
+		t.Errorf("evicted way %d, want the way not visited recently", wayID)
+	}
+}
+
+func TestSetLookupDistinguishesLevels(t *testing.T) {
+	set := NewSet(4)
+	wayID := fillSet(set, 1, 0, LevelL4)
+
+	if _, _, found := set.Lookup(1, 0, LevelL2); found {
+		t.Error("an L4 entry matched an L2 lookup of the same prefix")
+	}
+
+	got, _, found := set.Lookup(1, 0, LevelL4)
+	if !found || got != wayID {
+		t.Errorf("lookup = (%d, %v), want (%d, true)", got, found, wayID)
+	}
+
+	if set.Level(wayID) != LevelL4 {
+		t.Errorf("level = %d, want %d", set.Level(wayID), LevelL4)
+	}
+}
+
+func TestSetNeverEvictsPinnedWays(t *testing.T) {
+	set := NewSet(2)
+	way0 := fillSet(set, 1, 0x1000, LevelL2)
+	fillSet(set, 1, 0x2000, LevelL2)
+	set.Pin(way0)
+	set.Visit(1 - way0)
+
+	wayID, ok := set.Evict()
+	if !ok || wayID == way0 {
+		t.Errorf("evicted pinned way %d", wayID)
+	}
+
+	if set.NumPinned() != 1 {
+		t.Errorf("pinned ways = %d, want 1", set.NumPinned())
+	}
+}
+
+func TestSetDemotedWayIsEvictedFirst(t *testing.T) {
+	set := NewSet(2)
+	way0 := fillSet(set, 1, 0x1000, LevelL2)
+	fillSet(set, 1, 0x2000, LevelL2)
+	set.Demote(1 - way0)
+
+	wayID, ok := set.Evict()
+	if !ok || wayID != 1-way0 {
+		t.Errorf("evicted way %d, want the demoted way %d", wayID, 1-way0)
+	}
+}
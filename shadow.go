@@ -0,0 +1,83 @@
+package pwcache
+
+import (
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+// A ShadowConfig describes a tag array that observes the lookups and fills of
+// a PWC, so that another geometry or policy is evaluated in the same run. A
+// shadow holds no data, sends no message, and does not affect the timing of
+// the PWC.
+type ShadowConfig struct {
+	NumSets     int               `json:"num_sets" yaml:"num_sets"`
+	NumWays     int               `json:"num_ways" yaml:"num_ways"`
+	Insertion   InsertionPolicy   `json:"insertion" yaml:"insertion"`
+	Replacement ReplacementPolicy `json:"replacement" yaml:"replacement"`
+}
+
+// ShadowStats holds the counters of a shadow tag array.
+type ShadowStats struct {
+	Config ShadowConfig
+	Stats  Stats
+}
+
+// HitRate returns the fraction of the lookups that hit the level. The
+// LevelNone rate is the miss rate.
+func (s ShadowStats) HitRate(level int) float64 {
+	if s.Stats.Lookups == 0 {
+		return 0
+	}
+
+	return float64(s.Stats.LevelHits[level]) / float64(s.Stats.Lookups)
+}
+
+// Shadows returns the counters of the shadow tag arrays, in the order in which
+// they were added to the Builder.
+func (pwc *PWC) Shadows() []ShadowStats {
+	stats := make([]ShadowStats, len(pwc.shadows))
+	for i, s := range pwc.shadows {
+		stats[i] = ShadowStats{
+			Config: ShadowConfig{
+				NumSets:     s.numSets,
+				NumWays:     s.numWays,
+				Insertion:   s.insertion,
+				Replacement: s.replacement,
+			},
+			Stats: s.stats,
+		}
+	}
+
+	return stats
+}
+
+// newShadow returns a PWC without a component that only holds the sets of a
+// shadow. It shares the page geometry, the oracle, and the cost weights of
+// pwc, and neither partitions its ways nor pins entries.
+func (pwc *PWC) newShadow(c ShadowConfig) *PWC {
+	s := &PWC{
+		numSets:      c.NumSets,
+		numWays:      c.NumWays,
+		pageSize:     pwc.pageSize,
+		log2PageSize: pwc.log2PageSize,
+		insertion:    c.Insertion,
+		replacement:  c.Replacement,
+		future:       pwc.future,
+		costWeights:  pwc.costWeights,
+		reuseFilter:  newReuseFilter(c.NumSets * c.NumWays),
+		partition: newWayPartition(PartitionNone, c.NumWays,
+			[numLevels]int{}, 0),
+	}
+	if c.Replacement == ReplacementDueling {
+		s.dueling = newSetDueling(c.NumSets)
+	}
+	s.reset()
+
+	return s
+}
+
+// shadowLookup looks up vAddr in every shadow.
+func (pwc *PWC) shadowLookup(pid vm.PID, vAddr uint64) {
+	for _, s := range pwc.shadows {
+		s.recordLookup(s.lookup(pid, vAddr))
+	}
+}
@@ -0,0 +1,103 @@
+package pwcache
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShadowsObserveLookupsAndFills(t *testing.T) {
+	nextL3VAddr := sameL3VAddr + 1<<21
+	sequence := []uint64{baseVAddr, sameL3VAddr, nextL3VAddr, baseVAddr}
+
+	oracle := make([]Access, len(sequence))
+	for i, vAddr := range sequence {
+		oracle[i] = Access{PID: 1, VAddr: vAddr}
+	}
+
+	run := func(b Builder) *pwcHarness {
+		h := newPWCHarness(t, b.WithNumWays(4))
+		for _, vAddr := range sequence {
+			h.translate(1, vAddr)
+			h.run()
+		}
+
+		return h
+	}
+
+	plain := run(MakeBuilder())
+	shadowed := run(MakeBuilder().
+		WithOracle(NewOracle(oracle)).
+		WithShadow(ShadowConfig{NumSets: 1, NumWays: 4}).
+		WithShadow(ShadowConfig{NumSets: 1, NumWays: 4,
+			Replacement: ReplacementOPT}).
+		WithShadow(ShadowConfig{NumSets: 1, NumWays: 1}))
+
+	if !reflect.DeepEqual(shadowed.walkLatencies(), plain.walkLatencies()) {
+		t.Errorf("walk latencies = %v, want %v",
+			shadowed.walkLatencies(), plain.walkLatencies())
+	}
+
+	shadows := shadowed.pwc.Shadows()
+	if len(shadows) != 3 {
+		t.Fatalf("got %d shadows, want 3", len(shadows))
+	}
+
+	if shadows[0].Stats != plain.pwc.Stats() {
+		t.Errorf("same-geometry shadow stats = %+v, want %+v",
+			shadows[0].Stats, plain.pwc.Stats())
+	}
+
+	if got := shadows[1].Stats.LevelHits[LevelL2]; got != 1 {
+		t.Errorf("OPT shadow L2 hits = %d, want 1", got)
+	}
+
+	if got := shadows[2].HitRate(LevelNone); got != 1 {
+		t.Errorf("1-way shadow miss rate = %v, want 1", got)
+	}
+
+	shadowed.pwc.ResetStats()
+	if shadowed.pwc.Shadows()[0].Stats != (Stats{}) {
+		t.Error("ResetStats kept the shadow stats")
+	}
+}
+
+func TestWithConfigJSONDecodesShadows(t *testing.T) {
+	b, err := MakeBuilder().WithConfigJSON(strings.NewReader(`{
+		"shadows": [
+			{"num_sets": 4, "num_ways": 8, "insertion": "missing"},
+			{"num_sets": 1, "num_ways": 64, "replacement": "lru"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ShadowConfig{
+		{NumSets: 4, NumWays: 8, Insertion: InsertMissing},
+		{NumSets: 1, NumWays: 64},
+	}
+	if got := b.Config().Shadows; !reflect.DeepEqual(got, want) {
+		t.Errorf("shadows = %+v, want %+v", got, want)
+	}
+}
+
+func TestShadowsIndexSetsByLevelPrefix(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder().
+		WithShadow(ShadowConfig{NumSets: 1, NumWays: 4}).
+		WithShadow(ShadowConfig{NumSets: 4, NumWays: 4}))
+	for round := 0; round < 4; round++ {
+		for i := uint64(0); i < 8; i++ {
+			h.translate(1, baseVAddr+i<<21)
+			h.run()
+		}
+	}
+
+	shadows := h.pwc.Shadows()
+	oneSet := shadows[0].HitRate(LevelL2)
+	fourSets := shadows[1].HitRate(LevelL2)
+	if fourSets <= oneSet {
+		t.Errorf("L2 hit rate with 4 sets = %v, with 1 set %v, want more",
+			fourSets, oneSet)
+	}
+}
@@ -0,0 +1,582 @@
+package pwcache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/Sam-Yang6/pwcache/pwqueue"
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+// snapshotVersion changes whenever a snapshot gains state that a reader of
+// the previous version would silently drop. Restore rejects other versions.
+const (
+	snapshotFormat  = "pwcache-snapshot"
+	snapshotVersion = 2
+)
+
+// A PortResolver returns the port with the given name, or nil if there is
+// none. Restore uses it to reconnect the requests waiting in a snapshot to
+// the components that sent them.
+type PortResolver func(name string) sim.Port
+
+type snapshot struct {
+	Format     string            `json:"format"`
+	Version    int               `json:"version"`
+	NumSets    int               `json:"num_sets"`
+	NumWays    int               `json:"num_ways"`
+	Paused     bool              `json:"paused"`
+	Sets       []setSnapshot     `json:"sets"`
+	PinnedVA   []pinSnapshot     `json:"pinned_ranges,omitempty"`
+	MSHR       []mshrSnapshot    `json:"mshr"`
+	Responding *mshrSnapshot     `json:"responding,omitempty"`
+	PWQueue    []pwqueueSnapshot `json:"pwqueue"`
+	Stats      Stats             `json:"stats"`
+	Latencies  Latencies         `json:"latencies"`
+	OraclePos  int               `json:"oracle_pos,omitempty"`
+
+	DuelingCounter *int   `json:"dueling_counter,omitempty"`
+	NumBIPFills    uint64 `json:"num_bip_fills,omitempty"`
+
+	Arbiter     *arbiterSnapshot   `json:"arbiter,omitempty"`
+	Partition   partitionSnapshot  `json:"partition"`
+	ReuseFilter []reuseKeySnapshot `json:"reuse_filter,omitempty"`
+}
+
+type setSnapshot struct {
+	VisitCount uint64          `json:"visit_count"`
+	VisitOrder []int           `json:"visit_order"`
+	Blocks     []blockSnapshot `json:"blocks"`
+}
+
+type blockSnapshot struct {
+	Page      vm.Page `json:"page"`
+	Level     int     `json:"level"`
+	Owner     uint64  `json:"owner"`
+	Pinned    bool    `json:"pinned"`
+	LastVisit uint64  `json:"last_visit"`
+}
+
+type pinSnapshot struct {
+	PID   vm.PID `json:"pid"`
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+type reqSnapshot struct {
+	ID       string         `json:"id"`
+	Src      string         `json:"src"`
+	Dst      string         `json:"dst"`
+	SendTime sim.VTimeInSec `json:"send_time"`
+	RecvTime sim.VTimeInSec `json:"recv_time"`
+	PID      vm.PID         `json:"pid"`
+	VAddr    uint64         `json:"vaddr"`
+	DeviceID uint64         `json:"device_id"`
+}
+
+type mshrSnapshot struct {
+	PID      vm.PID        `json:"pid"`
+	VAddr    uint64        `json:"vaddr"`
+	DeviceID uint64        `json:"device_id"`
+	Page     vm.Page       `json:"page"`
+	HitLevel int           `json:"hit_level,omitempty"`
+	TracePos int           `json:"trace_pos,omitempty"`
+	Requests []reqSnapshot `json:"requests"`
+
+	LookupStart sim.VTimeInSec `json:"lookup_start,omitempty"`
+	LookupEnd   sim.VTimeInSec `json:"lookup_end,omitempty"`
+	WalkDone    sim.VTimeInSec `json:"walk_done,omitempty"`
+}
+
+type pwqueueSnapshot struct {
+	PID        vm.PID `json:"pid"`
+	VAddr      uint64 `json:"vaddr"`
+	Cyclesleft int    `json:"cycles_left"`
+	Hitlevel   int    `json:"hit_level"`
+	LookedUp   bool   `json:"looked_up,omitempty"`
+}
+
+type arbiterSnapshot struct {
+	Next   int                   `json:"next"`
+	Queues []deviceQueueSnapshot `json:"queues"`
+}
+
+type deviceQueueSnapshot struct {
+	DeviceID uint64        `json:"device_id"`
+	Credit   int           `json:"credit"`
+	Requests []reqSnapshot `json:"requests"`
+}
+
+type partitionSnapshot struct {
+	Reserved  [numLevels]int    `json:"reserved"`
+	Hits      [numLevels]uint64 `json:"hits"`
+	NumLookup uint64            `json:"num_lookup"`
+}
+
+type reuseKeySnapshot struct {
+	PID    vm.PID `json:"pid"`
+	Prefix uint64 `json:"prefix"`
+	Level  int    `json:"level"`
+}
+
+// Snapshot writes the state of the sets, the MSHR, the pwqueue, the device
+// queues, the way partition, the reuse filter, and the paused flag to w.
+// Requests that are queued at the ports or in flight in the low module are
+// not part of the snapshot. Neither are the shadows, the miss classifier, and
+// the reuse profiler, which only measure the run and keep the state of the
+// PWC that a snapshot is restored into.
+func (pwc *PWC) Snapshot(w io.Writer) error {
+	s := snapshot{
+		Format:  snapshotFormat,
+		Version: snapshotVersion,
+		NumSets: pwc.numSets,
+		NumWays: pwc.numWays,
+		Paused:  pwc.isPaused,
+		Stats:   pwc.stats,
+
+		Latencies: pwc.latencies,
+		Partition: partitionSnapshot{
+			Reserved:  pwc.partition.reserved,
+			Hits:      pwc.partition.hits,
+			NumLookup: pwc.partition.numLookup,
+		},
+	}
+
+	for _, key := range pwc.reuseFilter.order {
+		s.ReuseFilter = append(s.ReuseFilter,
+			reuseKeySnapshot{key.pid, key.prefix, key.level})
+	}
+
+	if a := pwc.arbiter; a != nil {
+		s.Arbiter = &arbiterSnapshot{Next: a.next}
+		for _, q := range a.queues {
+			qs := deviceQueueSnapshot{DeviceID: q.deviceID, Credit: q.credit}
+			for _, req := range q.reqs {
+				qs.Requests = append(qs.Requests, snapshotReq(req))
+			}
+
+			s.Arbiter.Queues = append(s.Arbiter.Queues, qs)
+		}
+	}
+
+	if pwc.future != nil {
+		s.OraclePos = pwc.future.numArrived
+	}
+
+	if pwc.dueling != nil {
+		counter := pwc.dueling.counter
+		s.DuelingCounter = &counter
+	}
+	s.NumBIPFills = pwc.numBIPFills
+
+	for setID, set := range pwc.Sets {
+		impl, ok := set.(*setImpl)
+		if !ok {
+			return fmt.Errorf("set %d of type %T cannot be snapshotted",
+				setID, set)
+		}
+
+		s.Sets = append(s.Sets, impl.snapshot())
+	}
+
+	for _, r := range pwc.pinnedRanges {
+		s.PinnedVA = append(s.PinnedVA, pinSnapshot{r.pid, r.start, r.end})
+	}
+
+	for _, e := range pwc.mshr.AllEntries() {
+		s.MSHR = append(s.MSHR, snapshotMSHREntry(e))
+	}
+
+	if pwc.respondingMSHREntry != nil {
+		e := snapshotMSHREntry(pwc.respondingMSHREntry)
+		s.Responding = &e
+	}
+
+	for i := 0; ; i++ {
+		pwe, err := pwc.pwqueue.Index(i)
+		if err != nil {
+			break
+		}
+
+		s.PWQueue = append(s.PWQueue, pwqueueSnapshot{
+			PID:        pwe.Req.PID,
+			VAddr:      pwe.Req.VAddr,
+			Cyclesleft: pwe.Cyclesleft,
+			Hitlevel:   pwe.Hitlevel,
+			LookedUp:   pwe.Inpwcache,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(s)
+}
+
+func (s *setImpl) snapshot() setSnapshot {
+	ss := setSnapshot{VisitCount: s.visitCount}
+
+	for _, b := range s.visitList {
+		ss.VisitOrder = append(ss.VisitOrder, b.wayID)
+	}
+
+	for _, b := range s.blocks {
+		ss.Blocks = append(ss.Blocks, blockSnapshot{
+			Page:      b.page,
+			Level:     b.level,
+			Owner:     b.owner,
+			Pinned:    b.pinned,
+			LastVisit: b.lastVisit,
+		})
+	}
+
+	return ss
+}
+
+func snapshotMSHREntry(e *mshrEntry) mshrSnapshot {
+	es := mshrSnapshot{
+		PID:      e.pid,
+		VAddr:    e.vAddr,
+		DeviceID: e.deviceID,
+		Page:     e.page,
+		HitLevel: e.hitlevel,
+		TracePos: e.tracePos,
+
+		LookupStart: e.lookupStart,
+		LookupEnd:   e.lookupEnd,
+		WalkDone:    e.walkDone,
+	}
+
+	for _, req := range e.Requests {
+		es.Requests = append(es.Requests, snapshotReq(req))
+	}
+
+	return es
+}
+
+func snapshotReq(req *vm.TranslationReq) reqSnapshot {
+	rs := reqSnapshot{
+		ID:       req.ID,
+		SendTime: req.SendTime,
+		RecvTime: req.RecvTime,
+		PID:      req.PID,
+		VAddr:    req.VAddr,
+		DeviceID: req.DeviceID,
+	}
+	if req.Src != nil {
+		rs.Src = req.Src.Name()
+	}
+	if req.Dst != nil {
+		rs.Dst = req.Dst.Name()
+	}
+
+	return rs
+}
+
+// Restore loads a snapshot written by Snapshot into a PWC that has just been
+// built with the same number of sets and ways. Waiting requests are attached
+// to the ports that resolve returns for their sources. Walks that were in
+// flight in the low module when the snapshot was taken are issued again
+// without being looked up or counted again.
+func (pwc *PWC) Restore(r io.Reader, resolve PortResolver) error {
+	var s snapshot
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return fmt.Errorf("cannot decode snapshot: %w", err)
+	}
+
+	if s.Format != snapshotFormat {
+		return fmt.Errorf("not a PWC snapshot: format %q", s.Format)
+	}
+
+	if s.Version != snapshotVersion {
+		return fmt.Errorf("unsupported snapshot version %d, want %d",
+			s.Version, snapshotVersion)
+	}
+
+	if s.NumSets != pwc.numSets || s.NumWays != pwc.numWays ||
+		len(s.Sets) != s.NumSets {
+		return fmt.Errorf("snapshot has %d sets of %d ways, PWC has %d of %d",
+			s.NumSets, s.NumWays, pwc.numSets, pwc.numWays)
+	}
+
+	if len(s.MSHR) > pwc.numMSHREntry {
+		return fmt.Errorf("snapshot has %d MSHR entries, PWC holds %d",
+			len(s.MSHR), pwc.numMSHREntry)
+	}
+
+	if len(s.PWQueue) > pwc.pwqueue.Capacity() {
+		return fmt.Errorf("snapshot has %d pwqueue entries, PWC holds %d",
+			len(s.PWQueue), pwc.pwqueue.Capacity())
+	}
+
+	sets := make([]Set, pwc.numSets)
+	for setID, ss := range s.Sets {
+		set, err := restoreSet(ss, pwc.numWays)
+		if err != nil {
+			return fmt.Errorf("set %d: %w", setID, err)
+		}
+
+		sets[setID] = set
+	}
+
+	var mshrEntries []*mshrEntry
+	for _, es := range s.MSHR {
+		e, err := pwc.restoreMSHREntry(es, resolve)
+		if err != nil {
+			return err
+		}
+
+		mshrEntries = append(mshrEntries, e)
+	}
+
+	for _, qs := range s.PWQueue {
+		if !hasMSHRSnapshot(s.MSHR, qs.PID, qs.VAddr) {
+			return fmt.Errorf("pwqueue entry (PID %d, VAddr 0x%x) "+
+				"has no MSHR entry", qs.PID, qs.VAddr)
+		}
+	}
+
+	queues, err := pwc.restoreArbiter(s.Arbiter, resolve)
+	if err != nil {
+		return err
+	}
+
+	var responding *mshrEntry
+	if s.Responding != nil {
+		e, err := pwc.restoreMSHREntry(*s.Responding, resolve)
+		if err != nil {
+			return err
+		}
+
+		responding = e
+	}
+
+	pwc.Sets = sets
+	pwc.isPaused = s.Paused
+	pwc.stats = s.Stats
+	pwc.latencies = s.Latencies
+	if pwc.future != nil {
+		pwc.future.numArrived = s.OraclePos
+	}
+	if pwc.dueling != nil && s.DuelingCounter != nil {
+		pwc.dueling.counter = *s.DuelingCounter
+	}
+	pwc.numBIPFills = s.NumBIPFills
+	pwc.respondingMSHREntry = responding
+
+	pwc.partition.reserved = s.Partition.Reserved
+	pwc.partition.hits = s.Partition.Hits
+	pwc.partition.numLookup = s.Partition.NumLookup
+
+	pwc.reuseFilter = newReuseFilter(pwc.reuseFilter.capacity)
+	for _, k := range s.ReuseFilter {
+		pwc.reuseFilter.seenBefore(k.PID, k.Prefix, k.Level)
+	}
+
+	if pwc.arbiter != nil && s.Arbiter != nil {
+		pwc.arbiter.queues = queues
+		pwc.arbiter.byID = make(map[uint64]*deviceQueue)
+		for _, q := range queues {
+			pwc.arbiter.byID[q.deviceID] = q
+		}
+		pwc.arbiter.next = s.Arbiter.Next
+	}
+
+	pwc.pinnedRanges = nil
+	for _, p := range s.PinnedVA {
+		pwc.pinnedRanges = append(pwc.pinnedRanges,
+			pinRange{pid: p.PID, start: p.Start, end: p.End})
+	}
+
+	pwc.mshr.Reset()
+	for _, e := range mshrEntries {
+		restored := pwc.mshr.Add(e.pid, e.vAddr)
+		*restored = *e
+	}
+
+	pwc.pwqueue.Reset()
+	for _, qs := range s.PWQueue {
+		e := pwc.mshr.Query(qs.PID, qs.VAddr)
+		pwe := pwqueue.Newpwqueueentry(e.Requests[0], qs.Hitlevel)
+		pwe.Cyclesleft = qs.Cyclesleft
+		e.replay = qs.LookedUp
+		_ = pwc.pwqueue.Enqueue(pwe)
+	}
+
+	pwc.TickLater(pwc.Engine.CurrentTime())
+
+	return nil
+}
+
+func hasMSHRSnapshot(entries []mshrSnapshot, pid vm.PID, vAddr uint64) bool {
+	for _, es := range entries {
+		if es.PID == pid && es.VAddr == vAddr && len(es.Requests) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func restoreSet(ss setSnapshot, numWays int) (*setImpl, error) {
+	if len(ss.Blocks) != numWays || len(ss.VisitOrder) > numWays {
+		return nil, fmt.Errorf("has %d blocks and %d visited ways, want %d",
+			len(ss.Blocks), len(ss.VisitOrder), numWays)
+	}
+
+	s := NewSet(numWays).(*setImpl)
+	s.visitCount = ss.VisitCount
+
+	for wayID, bs := range ss.Blocks {
+		b := s.blocks[wayID]
+		b.page = bs.Page
+		b.level = bs.Level
+		b.owner = bs.Owner
+		b.pinned = bs.Pinned
+		b.lastVisit = bs.LastVisit
+
+		if b.pinned {
+			s.numPinned++
+		}
+
+		if b.level != LevelNone {
+			key := s.keyString(b.page.PID, b.page.VAddr, b.level)
+			s.vAddrWayIDMap[key] = wayID
+		}
+	}
+
+	s.visitList = s.visitList[:0]
+	for _, wayID := range ss.VisitOrder {
+		if wayID < 0 || wayID >= numWays {
+			return nil, fmt.Errorf("visit order has way %d", wayID)
+		}
+
+		s.visitList = append(s.visitList, s.blocks[wayID])
+	}
+
+	sort.SliceStable(s.visitList, func(i, j int) bool {
+		return s.visitList[i].lastVisit < s.visitList[j].lastVisit
+	})
+
+	return s, nil
+}
+
+func (pwc *PWC) restoreMSHREntry(
+	es mshrSnapshot,
+	resolve PortResolver,
+) (*mshrEntry, error) {
+	e := newMSHREntry()
+	e.pid = es.PID
+	e.vAddr = es.VAddr
+	e.deviceID = es.DeviceID
+	e.page = es.Page
+	e.hitlevel = es.HitLevel
+	e.tracePos = es.TracePos
+	e.lookupStart = es.LookupStart
+	e.lookupEnd = es.LookupEnd
+	e.walkDone = es.WalkDone
+
+	for _, rs := range es.Requests {
+		req, err := pwc.restoreReq(rs, resolve)
+		if err != nil {
+			return nil, err
+		}
+
+		e.Requests = append(e.Requests, req)
+	}
+
+	return e, nil
+}
+
+func (pwc *PWC) restoreReq(
+	rs reqSnapshot,
+	resolve PortResolver,
+) (*vm.TranslationReq, error) {
+	src := resolve(rs.Src)
+	if src == nil {
+		return nil, fmt.Errorf("cannot resolve port %q of request %s",
+			rs.Src, rs.ID)
+	}
+
+	dst := pwc.topPortNamed(rs.Dst)
+	if dst == nil {
+		return nil, fmt.Errorf("PWC has no top port %q for request %s",
+			rs.Dst, rs.ID)
+	}
+
+	req := &vm.TranslationReq{
+		PID:      rs.PID,
+		VAddr:    rs.VAddr,
+		DeviceID: rs.DeviceID,
+	}
+	req.ID = rs.ID
+	req.Src = src
+	req.Dst = dst
+	req.SendTime = rs.SendTime
+	req.RecvTime = rs.RecvTime
+
+	return req, nil
+}
+
+// restoreArbiter returns the device queues of the snapshot, ready to replace
+// those of the arbiter.
+func (pwc *PWC) restoreArbiter(
+	as *arbiterSnapshot,
+	resolve PortResolver,
+) ([]*deviceQueue, error) {
+	if as == nil {
+		return nil, nil
+	}
+
+	if pwc.arbiter == nil {
+		for _, qs := range as.Queues {
+			if len(qs.Requests) > 0 {
+				return nil, errors.New(
+					"snapshot has queued requests, PWC has no arbiter")
+			}
+		}
+
+		return nil, nil
+	}
+
+	var queues []*deviceQueue
+	for _, qs := range as.Queues {
+		if len(qs.Requests) > pwc.arbiter.queueSize {
+			return nil, fmt.Errorf("snapshot has %d requests of device %d, "+
+				"PWC queues %d", len(qs.Requests), qs.DeviceID,
+				pwc.arbiter.queueSize)
+		}
+
+		q := &deviceQueue{deviceID: qs.DeviceID, credit: qs.Credit}
+		for _, rs := range qs.Requests {
+			req, err := pwc.restoreReq(rs, resolve)
+			if err != nil {
+				return nil, err
+			}
+
+			q.reqs = append(q.reqs, req)
+		}
+
+		queues = append(queues, q)
+	}
+
+	if len(queues) > 0 && (as.Next < 0 || as.Next >= len(queues)) {
+		return nil, fmt.Errorf("arbiter turn %d is out of %d devices",
+			as.Next, len(queues))
+	}
+
+	return queues, nil
+}
+
+func (pwc *PWC) topPortNamed(name string) sim.Port {
+	for _, port := range pwc.topPorts {
+		if port.Name() == name {
+			return port
+		}
+	}
+
+	return nil
+}
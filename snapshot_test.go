@@ -0,0 +1,192 @@
+package pwcache
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Sam-Yang6/pwcache/pwqueue"
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+func (h *pwcHarness) resolvePort(name string) sim.Port {
+	if name == h.top.port.Name() {
+		return h.top.port
+	}
+
+	return nil
+}
+
+func TestSnapshotRestoresSetContents(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	h.translate(1, baseVAddr)
+	h.run()
+
+	var buf bytes.Buffer
+	if err := h.pwc.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newPWCHarness(t, MakeBuilder())
+	if err := restored.pwc.Restore(&buf, restored.resolvePort); err != nil {
+		t.Fatal(err)
+	}
+
+	restored.translate(1, sameL2VAddr)
+	restored.run()
+
+	if got := restored.walkLatencies(); !reflect.DeepEqual(got, []int{100}) {
+		t.Errorf("walk latencies = %v, want [100]", got)
+	}
+}
+
+func TestSnapshotRestoresPendingRequests(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	req := vm.TranslationReqBuilder{}.
+		WithSrc(h.top.port).
+		WithDst(h.pwc.topPort).
+		WithPID(1).
+		WithVAddr(baseVAddr).
+		Build()
+	e := h.pwc.mshr.Add(req.PID, req.VAddr)
+	e.Requests = append(e.Requests, req)
+	h.pwc.pwqueue.Enqueue(pwqueue.Newpwqueueentry(req, 0))
+
+	var buf bytes.Buffer
+	if err := h.pwc.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := newPWCHarness(t, MakeBuilder())
+	if err := restored.pwc.Restore(&buf, restored.resolvePort); err != nil {
+		t.Fatal(err)
+	}
+	restored.run()
+
+	rsps := restored.top.translationRsps()
+	if len(rsps) != 1 || rsps[0].RespondTo != req.ID {
+		t.Fatalf("restored request was not answered")
+	}
+}
+
+func TestRestoreRejectsMismatchedGeometry(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+
+	var buf bytes.Buffer
+	if err := h.pwc.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	other := newPWCHarness(t, MakeBuilder().WithNumWays(16))
+	err := other.pwc.Restore(&buf, other.resolvePort)
+	if err == nil || !strings.Contains(err.Error(), "ways") {
+		t.Errorf("err = %v, want a geometry mismatch", err)
+	}
+}
+
+// snapshotInto snapshots the PWC of h and restores it into a new harness of
+// the builder.
+func (h *pwcHarness) snapshotInto(b Builder) *pwcHarness {
+	var buf bytes.Buffer
+	if err := h.pwc.Snapshot(&buf); err != nil {
+		h.t.Fatal(err)
+	}
+
+	restored := newPWCHarness(h.t, b)
+	if err := restored.pwc.Restore(&buf, restored.resolvePort); err != nil {
+		h.t.Fatal(err)
+	}
+
+	return restored
+}
+
+func TestSnapshotRestoresArbiterQueues(t *testing.T) {
+	b := MakeBuilder().WithArbitrationPolicy(ArbitrationRoundRobin)
+	h := newPWCHarness(t, b)
+	req := vm.TranslationReqBuilder{}.
+		WithSrc(h.top.port).
+		WithDst(h.pwc.topPort).
+		WithPID(1).
+		WithVAddr(baseVAddr).
+		WithDeviceID(3).
+		Build()
+	h.pwc.arbiter.accept(req)
+
+	restored := h.snapshotInto(b)
+	restored.run()
+
+	rsps := restored.top.translationRsps()
+	if len(rsps) != 1 || rsps[0].RespondTo != req.ID {
+		t.Fatalf("queued request was not answered after a restore")
+	}
+}
+
+func TestRestoredWalkIsNotLookedUpAgain(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	req := vm.TranslationReqBuilder{}.
+		WithSrc(h.top.port).
+		WithDst(h.pwc.topPort).
+		WithPID(1).
+		WithVAddr(baseVAddr).
+		Build()
+	e := h.pwc.mshr.Add(req.PID, req.VAddr)
+	e.Requests = append(e.Requests, req)
+	pwe := pwqueue.Newpwqueueentry(req, LevelNone)
+	pwe.Cyclesleft = 0
+	pwe.Inpwcache = true
+	h.pwc.pwqueue.Enqueue(pwe)
+	h.pwc.recordLookup(LevelNone)
+
+	restored := h.snapshotInto(MakeBuilder())
+	restored.run()
+
+	if len(restored.top.translationRsps()) != 1 {
+		t.Fatal("restored walk was not answered")
+	}
+
+	if got := restored.pwc.Stats().Lookups; got != 1 {
+		t.Errorf("lookups = %d, want 1", got)
+	}
+
+	if got := restored.walkLatencies(); !reflect.DeepEqual(got, []int{400}) {
+		t.Errorf("walk latencies = %v, want [400]", got)
+	}
+}
+
+func TestSnapshotRestoresAdaptivePartition(t *testing.T) {
+	b := MakeBuilder().
+		WithNumWays(8).
+		WithPartitionMode(PartitionAdaptive).
+		WithPartitionEpoch(2)
+	h := newPWCHarness(t, b)
+	h.translate(1, baseVAddr)
+	h.run()
+	h.translate(1, sameL2VAddr)
+	h.run()
+
+	restored := h.snapshotInto(b)
+	for _, level := range cachedLevels {
+		if got, want := restored.pwc.ReservedWays(level),
+			h.pwc.ReservedWays(level); got != want {
+			t.Errorf("level %d: %d reserved ways, want %d", level, got, want)
+		}
+	}
+}
+
+func TestSnapshotRestoresReuseFilter(t *testing.T) {
+	b := MakeBuilder().WithInsertionPolicy(InsertBypassLowReuse)
+	h := newPWCHarness(t, b)
+	h.translate(1, baseVAddr)
+	h.run()
+
+	restored := h.snapshotInto(b)
+	restored.translate(1, baseVAddr)
+	restored.run()
+
+	if got := restored.pwc.Stats().Fills; got != [numLevels]uint64{0, 1, 1, 1} {
+		t.Errorf("fills = %v, want the levels walked before the snapshot",
+			got)
+	}
+}
@@ -0,0 +1,54 @@
+package pwcache
+
+// Stats holds the counters that a PWC accumulates. Arrays are indexed by
+// page-table level; the LevelNone slot of LevelHits counts the lookups that
+// missed every level.
+type Stats struct {
+	Lookups   uint64
+	LevelHits [numLevels]uint64
+
+	// Fills counts the entries inserted into the sets.
+	Fills [numLevels]uint64
+
+	// FillsPresent counts the fills avoided because the prefix was already
+	// cached.
+	FillsPresent [numLevels]uint64
+
+	// FillsBypassed counts the fills skipped because the insertion policy
+	// rejected the entry, or because the way partition or the device way
+	// quota protected every way that the fill could replace.
+	FillsBypassed [numLevels]uint64
+}
+
+// FillsAvoided returns the number of fills of the level that did not insert a
+// new entry.
+func (s Stats) FillsAvoided(level int) uint64 {
+	return s.FillsPresent[level] + s.FillsBypassed[level]
+}
+
+// Stats returns a copy of the counters accumulated so far.
+func (pwc *PWC) Stats() Stats {
+	return pwc.stats
+}
+
+// ResetStats clears all the counters, including those of the shadow tag
+// arrays and of the set dueling, the latency histograms, the miss
+// classification, and the reuse profile. The entries of the sets, the
+// shadows, the shadow of the miss classification, the stack of the reuse
+// profile, and the policy selector of the set dueling are kept.
+func (pwc *PWC) ResetStats() {
+	pwc.stats = Stats{}
+	pwc.latencies = Latencies{}
+	if pwc.missClassifier != nil {
+		pwc.missClassifier.reset()
+	}
+	if pwc.reuseProfiler != nil {
+		pwc.reuseProfiler.reset()
+	}
+	if pwc.dueling != nil {
+		pwc.dueling.reset()
+	}
+	for _, s := range pwc.shadows {
+		s.ResetStats()
+	}
+}
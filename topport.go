@@ -0,0 +1,150 @@
+package pwcache
+
+import (
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+)
+
+// peekTopPorts returns the first request waiting at the top ports, starting
+// from the port after the one served last. The port stays selected until the
+// request is retrieved.
+func (pwc *PWC) peekTopPorts() *vm.TranslationReq {
+	pwc.selectedTopPort = nil
+
+	for i := 0; i < len(pwc.topPorts); i++ {
+		port := pwc.topPorts[(pwc.nextTopPort+i)%len(pwc.topPorts)]
+		msg := port.Peek()
+		if msg == nil {
+			continue
+		}
+
+		pwc.selectedTopPort = port
+		return msg.(*vm.TranslationReq)
+	}
+
+	return nil
+}
+
+// retrieveTopPorts removes the request returned by the last peekTopPorts and
+// passes the turn to the next port.
+func (pwc *PWC) retrieveTopPorts(now sim.VTimeInSec) {
+	pwc.selectedTopPort.Retrieve(now)
+
+	for i, port := range pwc.topPorts {
+		if port == pwc.selectedTopPort {
+			pwc.nextTopPort = (i + 1) % len(pwc.topPorts)
+		}
+	}
+
+	pwc.selectedTopPort = nil
+}
+
+// acceptTopReqs moves the requests that arrived at the top ports into the
+// per-device queues, one request per port in turn starting from the port
+// after the one served last, so that a busy port does not starve the others.
+func (pwc *PWC) acceptTopReqs(now sim.VTimeInSec) bool {
+	if pwc.arbiter == nil {
+		return false
+	}
+
+	madeProgress := false
+	for pwc.acceptTopReq(now) {
+		madeProgress = true
+	}
+
+	return madeProgress
+}
+
+// acceptTopReq moves one request from the top ports into its device queue.
+func (pwc *PWC) acceptTopReq(now sim.VTimeInSec) bool {
+	for i := 0; i < len(pwc.topPorts); i++ {
+		portID := (pwc.nextTopPort + i) % len(pwc.topPorts)
+		port := pwc.topPorts[portID]
+		msg := port.Peek()
+		if msg == nil {
+			continue
+		}
+
+		req := msg.(*vm.TranslationReq)
+		if !pwc.arbiter.canAccept(req) {
+			continue
+		}
+
+		port.Retrieve(now)
+		pwc.arbiter.accept(req)
+		pwc.nextTopPort = (portID + 1) % len(pwc.topPorts)
+		return true
+	}
+
+	return false
+}
+
+// peekTopReq returns the request that MSHRlookup should process next.
+func (pwc *PWC) peekTopReq() *vm.TranslationReq {
+	if pwc.arbiter == nil {
+		return pwc.peekTopPorts()
+	}
+
+	return pwc.arbiter.peek(func(req *vm.TranslationReq) bool {
+		return pwc.withinMSHRShare(req) && pwc.canTakeNow(req)
+	})
+}
+
+// canTakeNow checks if MSHRlookup can take the request this cycle, either by
+// merging it into an MSHR entry or by allocating one. The arbiter skips the
+// devices whose head request must wait, so that they do not block the
+// requests of the other devices that would merge.
+func (pwc *PWC) canTakeNow(req *vm.TranslationReq) bool {
+	if pwc.mshr.Query(req.PID, req.VAddr) != nil {
+		return true
+	}
+
+	return !pwc.mshr.IsFull() && !pwc.pwqueue.IsFull()
+}
+
+// retrieveTopReq removes the request returned by the last peekTopReq.
+func (pwc *PWC) retrieveTopReq(now sim.VTimeInSec) {
+	if pwc.future != nil {
+		pwc.future.arrive()
+	}
+
+	if pwc.arbiter == nil {
+		pwc.retrieveTopPorts(now)
+		return
+	}
+
+	pwc.arbiter.retrieve()
+}
+
+// replyPort returns the top port that a request arrived at, through which its
+// response must be sent.
+func (pwc *PWC) replyPort(req *vm.TranslationReq) sim.Port {
+	return req.Dst
+}
+
+// drainTopPorts discards all the requests waiting at the top ports and in the
+// device queues, and returns how many there were.
+func (pwc *PWC) drainTopPorts(now sim.VTimeInSec) int {
+	var discarded []*vm.TranslationReq
+	for _, port := range pwc.topPorts {
+		for msg := port.Retrieve(now); msg != nil; msg = port.Retrieve(now) {
+			discarded = append(discarded, msg.(*vm.TranslationReq))
+		}
+	}
+
+	if pwc.arbiter != nil {
+		for _, q := range pwc.arbiter.queues {
+			discarded = append(discarded, q.reqs...)
+		}
+
+		pwc.arbiter.reset()
+	}
+
+	if pwc.recorder != nil {
+		for _, req := range discarded {
+			pwc.recorder.discard(req)
+		}
+	}
+
+	return len(discarded)
+}
@@ -0,0 +1,147 @@
+package pwcache
+
+import (
+	"github.com/sarchlab/akita/v3/mem/vm"
+	"github.com/sarchlab/akita/v3/sim"
+	"github.com/sarchlab/akita/v3/tracing"
+)
+
+// Kinds of the sub-tasks that break down the handling of a translation
+// request. The queue wait, lookup, and respond phases are children of the
+// request's req_in task. The walk-level tasks are children of the req_out task
+// of the TranslationReqpwc sent to the low module.
+const (
+	taskKindQueueWait = "queue_wait"
+	taskKindLookup    = "lookup"
+	taskKindWalkLevel = "walk_level"
+	taskKindRespond   = "respond"
+)
+
+// walkLevelNames names the page table level that a walk accesses at each of
+// its steps, from the L4 table to the leaf table.
+var walkLevelNames = [...]string{"", "l4", "l3", "l2", "l1"}
+
+// startPhase ends the open phase of req, if any, and starts a new one.
+func (pwc *PWC) startPhase(req *vm.TranslationReq, kind, what string) {
+	if pwc.NumHooks() == 0 {
+		return
+	}
+
+	pwc.endPhase(req)
+
+	parentID := tracing.MsgIDAtReceiver(req, pwc)
+	id := parentID + "_" + kind
+	tracing.StartTask(id, parentID, pwc, kind, what, nil)
+
+	if pwc.openPhases == nil {
+		pwc.openPhases = make(map[string]string)
+	}
+	pwc.openPhases[parentID] = id
+}
+
+// endPhase ends the open phase of req, if any.
+func (pwc *PWC) endPhase(req *vm.TranslationReq) {
+	parentID := tracing.MsgIDAtReceiver(req, pwc)
+	id, found := pwc.openPhases[parentID]
+	if !found {
+		return
+	}
+
+	tracing.EndTask(id, pwc)
+	delete(pwc.openPhases, parentID)
+}
+
+// A walkTrace follows the page table levels accessed by a walk that the low
+// module performs, assuming that each level takes levelLatency cycles.
+type walkTrace struct {
+	taskID string
+	level  int
+	done   bool
+}
+
+func (w *walkTrace) levelTaskID(level int) string {
+	return w.taskID + "_" + walkLevelNames[level]
+}
+
+// walkLevelEvent moves a walkTrace to the next level.
+type walkLevelEvent struct {
+	*sim.EventBase
+	walk  *walkTrace
+	level int
+}
+
+// walkLevelTracer handles walkLevelEvents. Being separate from the PWC, it
+// traces the levels without adding ticks to the PWC.
+type walkLevelTracer struct {
+	pwc *PWC
+}
+
+func (t walkLevelTracer) Handle(e sim.Event) error {
+	evt := e.(walkLevelEvent)
+	if evt.walk.done {
+		return nil
+	}
+
+	t.pwc.startWalkLevel(evt.walk, evt.level)
+	return nil
+}
+
+// traceWalk starts the task of the first level that the walk sent by
+// fetchBottom accesses and schedules the start of the others.
+func (pwc *PWC) traceWalk(
+	now sim.VTimeInSec,
+	fetch *TranslationReqpwc,
+	hitlevel int,
+) *walkTrace {
+	if pwc.NumHooks() == 0 {
+		return nil
+	}
+
+	w := &walkTrace{taskID: fetch.ID + "_req_out"}
+	pwc.startWalkLevel(w, hitlevel+1)
+
+	for level := hitlevel + 2; level < len(walkLevelNames); level++ {
+		cycles := pwc.levelLatency * (level - hitlevel - 1)
+		pwc.Engine.Schedule(walkLevelEvent{
+			EventBase: sim.NewEventBase(pwc.Freq.NCyclesLater(cycles, now),
+				walkLevelTracer{pwc: pwc}),
+			walk:  w,
+			level: level,
+		})
+	}
+
+	return w
+}
+
+func (pwc *PWC) startWalkLevel(w *walkTrace, level int) {
+	if w.level != LevelNone {
+		tracing.EndTask(w.levelTaskID(w.level), pwc)
+	}
+
+	w.level = level
+	tracing.StartTask(w.levelTaskID(level), w.taskID, pwc,
+		taskKindWalkLevel, walkLevelNames[level], nil)
+}
+
+// endWalk ends the task of the level that the walk is accessing.
+func (pwc *PWC) endWalk(w *walkTrace) {
+	if w == nil || w.done {
+		return
+	}
+
+	tracing.EndTask(w.levelTaskID(w.level), pwc)
+	w.done = true
+}
+
+// abortTraces ends the tasks of an MSHR entry that a flush drops.
+func (pwc *PWC) abortTraces(e *mshrEntry) {
+	pwc.endWalk(e.walk)
+	if e.reqToBottom != nil {
+		tracing.TraceReqFinalize(e.reqToBottom, pwc)
+	}
+
+	for _, req := range e.Requests {
+		pwc.endPhase(req)
+		tracing.TraceReqComplete(req, pwc)
+	}
+}
@@ -0,0 +1,113 @@
+package pwcache
+
+import (
+	"testing"
+
+	"github.com/sarchlab/akita/v3/sim"
+	"github.com/sarchlab/akita/v3/tracing"
+)
+
+// taskCollector is a tracer that keeps every task with its start and end
+// times.
+type taskCollector struct {
+	engine sim.Engine
+	tasks  map[string]*tracing.Task
+	ended  map[string]bool
+}
+
+func newTaskCollector(engine sim.Engine) *taskCollector {
+	return &taskCollector{
+		engine: engine,
+		tasks:  make(map[string]*tracing.Task),
+		ended:  make(map[string]bool),
+	}
+}
+
+func (c *taskCollector) StartTask(task tracing.Task) {
+	if _, found := c.tasks[task.ID]; found {
+		panic("task " + task.ID + " started twice")
+	}
+
+	task.StartTime = c.engine.CurrentTime()
+	c.tasks[task.ID] = &task
+}
+
+func (c *taskCollector) StepTask(tracing.Task) {}
+
+func (c *taskCollector) EndTask(task tracing.Task) {
+	if t, found := c.tasks[task.ID]; found {
+		t.EndTime = c.engine.CurrentTime()
+		c.ended[task.ID] = true
+	}
+}
+
+// children returns the kinds and whats of the tasks whose parent is id.
+func (c *taskCollector) children(id string) map[string]*tracing.Task {
+	children := make(map[string]*tracing.Task)
+	for _, t := range c.tasks {
+		if t.ParentID == id {
+			children[t.Kind+"/"+t.What] = t
+		}
+	}
+
+	return children
+}
+
+func TestTracingBreaksWalkIntoPhases(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	c := newTaskCollector(h.engine)
+	tracing.CollectTrace(h.pwc, c)
+
+	req := h.translate(1, baseVAddr)
+	merged := h.translate(1, baseVAddr)
+	h.run()
+
+	for id := range c.tasks {
+		if !c.ended[id] {
+			t.Errorf("task %s did not end", id)
+		}
+	}
+
+	reqTaskID := tracing.MsgIDAtReceiver(req, h.pwc)
+	phases := c.children(reqTaskID)
+	for _, name := range []string{
+		"queue_wait/pwqueue", "lookup/sets", "respond/rsp",
+	} {
+		if phases[name] == nil {
+			t.Errorf("request has no %s phase, has %v", name, phases)
+		}
+	}
+
+	var walk *tracing.Task
+	for _, task := range phases {
+		if task.Kind == "req_out" {
+			walk = task
+		}
+	}
+	if walk == nil {
+		t.Fatal("request has no walk task")
+	}
+
+	levels := c.children(walk.ID)
+	if len(levels) != 4 {
+		t.Fatalf("walk has %d levels, want 4", len(levels))
+	}
+
+	l4 := levels["walk_level/l4"]
+	l1 := levels["walk_level/l1"]
+	if l4.StartTime != walk.StartTime || l1.EndTime != walk.EndTime {
+		t.Errorf("levels span %v-%v, walk spans %v-%v",
+			l4.StartTime, l1.EndTime, walk.StartTime, walk.EndTime)
+	}
+
+	cycles := h.pwc.Freq.Cycle(l4.EndTime) - h.pwc.Freq.Cycle(l4.StartTime)
+	if cycles != 100 {
+		t.Errorf("l4 level lasts %d cycles, want 100", cycles)
+	}
+
+	mergedPhases := c.children(tracing.MsgIDAtReceiver(merged, h.pwc))
+	if mergedPhases["queue_wait/mshr"] == nil ||
+		mergedPhases["respond/rsp"] == nil {
+		t.Errorf("merged request phases = %v", mergedPhases)
+	}
+}
@@ -0,0 +1,36 @@
+package pwcache
+
+import (
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+// An Access is the translation of a virtual address of a process.
+type Access struct {
+	PID   vm.PID
+	VAddr uint64
+}
+
+// WarmUp replays the accesses functionally before timing starts. Each access
+// looks up the sets and then fills the levels of its walk with the same
+// insertion and replacement logic as a timed walk. No message is sent, no
+// time passes, and no hook is invoked. The statistics are reset afterwards.
+func (pwc *PWC) WarmUp(accesses []Access) {
+	pwc.warmingUp = true
+	defer func() { pwc.warmingUp = false }()
+
+	for _, a := range accesses {
+		hitlevel := pwc.lookup(a.PID, a.VAddr)
+		pwc.classifyMisses(a.PID, a.VAddr, hitlevel)
+		pwc.profileReuse(a.PID, a.VAddr)
+		pwc.shadowLookup(a.PID, a.VAddr)
+		pwc.recordLookup(hitlevel)
+		pwc.fillWalk(vm.Page{
+			PID:      a.PID,
+			VAddr:    a.VAddr >> pwc.log2PageSize << pwc.log2PageSize,
+			PageSize: pwc.pageSize,
+			Valid:    true,
+		}, 0)
+	}
+
+	pwc.ResetStats()
+}
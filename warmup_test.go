@@ -0,0 +1,26 @@
+package pwcache
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestWarmUpFillsWithoutTraffic(t *testing.T) {
+	h := newPWCHarness(t, MakeBuilder())
+	h.pwc.WarmUp([]Access{{PID: 1, VAddr: baseVAddr}, {PID: 1, VAddr: sameL2VAddr}})
+
+	if len(h.low.received) != 0 {
+		t.Errorf("warm-up sent %d walks", len(h.low.received))
+	}
+
+	if h.pwc.Stats() != (Stats{}) {
+		t.Errorf("stats were not reset: %+v", h.pwc.Stats())
+	}
+
+	h.translate(1, sameL3VAddr)
+	h.run()
+
+	if got := h.walkLatencies(); !reflect.DeepEqual(got, []int{200}) {
+		t.Errorf("walk latencies = %v, want [200]", got)
+	}
+}
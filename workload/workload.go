@@ -0,0 +1,236 @@
+// Package workload generates synthetic translation request streams that
+// follow common GPU access patterns.
+package workload
+
+import (
+	"log"
+	"math/bits"
+	"math/rand"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+// A Generator produces an endless sequence of translation requests. The
+// requests have no source or destination; the component that sends them sets
+// those.
+type Generator interface {
+	Next() *vm.TranslationReq
+}
+
+// Take returns the next n requests of g.
+func Take(g Generator, n int) []*vm.TranslationReq {
+	reqs := make([]*vm.TranslationReq, 0, n)
+	for i := 0; i < n; i++ {
+		reqs = append(reqs, g.Next())
+	}
+
+	return reqs
+}
+
+// A Builder can build Generators. All the generators touch the pages of a
+// footprint that starts at a base virtual address.
+type Builder struct {
+	pid       vm.PID
+	deviceID  uint64
+	base      uint64
+	footprint uint64
+	pageSize  uint64
+	seed      int64
+}
+
+// MakeBuilder returns a Builder
+func MakeBuilder() Builder {
+	return Builder{
+		pid:       1,
+		footprint: 1 << 30,
+		pageSize:  4096,
+		seed:      1,
+	}
+}
+
+// WithPID sets the process of the requests
+func (b Builder) WithPID(pid vm.PID) Builder {
+	b.pid = pid
+	return b
+}
+
+// WithDeviceID sets the GPU that sends the requests
+func (b Builder) WithDeviceID(deviceID uint64) Builder {
+	b.deviceID = deviceID
+	return b
+}
+
+// WithBase sets the first virtual address of the footprint
+func (b Builder) WithBase(base uint64) Builder {
+	b.base = base
+	return b
+}
+
+// WithFootprint sets the number of bytes that the requests touch
+func (b Builder) WithFootprint(footprint uint64) Builder {
+	b.footprint = footprint
+	return b
+}
+
+// WithPageSize sets the page size. Requests translate page-aligned addresses.
+func (b Builder) WithPageSize(pageSize uint64) Builder {
+	b.pageSize = pageSize
+	return b
+}
+
+// WithSeed sets the seed of the generators that use random numbers
+func (b Builder) WithSeed(seed int64) Builder {
+	b.seed = seed
+	return b
+}
+
+// BuildStream creates a Generator that walks the footprint page by page and
+// starts over at the end.
+func (b Builder) BuildStream() Generator {
+	return b.BuildStrided(b.pageSize)
+}
+
+// BuildStrided creates a Generator that advances by stride bytes and wraps
+// around the whole pages of the footprint. The stride must be a positive
+// multiple of the page size, so that every address is page-aligned.
+func (b Builder) BuildStrided(stride uint64) Generator {
+	b.mustBeValid()
+	if stride == 0 || stride%b.pageSize != 0 {
+		log.Panicf("stride %d is not a positive multiple of the page size %d",
+			stride, b.pageSize)
+	}
+
+	return &stridedGenerator{Builder: b, stride: stride}
+}
+
+// BuildRandom creates a Generator that picks pages of the footprint
+// uniformly.
+func (b Builder) BuildRandom() Generator {
+	b.mustBeValid()
+	return &randomGenerator{
+		Builder: b,
+		rng:     rand.New(rand.NewSource(b.seed)),
+	}
+}
+
+// BuildPowerLaw creates a Generator that picks pages with a Zipf distribution
+// of exponent alpha, which must be greater than 1, as graph workloads do with
+// the adjacency lists of their vertices. The popular pages are scattered over
+// the footprint.
+func (b Builder) BuildPowerLaw(alpha float64) Generator {
+	b.mustBeValid()
+	if alpha <= 1 {
+		log.Panicf("power-law exponent must be greater than 1, got %v", alpha)
+	}
+
+	rng := rand.New(rand.NewSource(b.seed))
+	numPages := b.numPages()
+
+	// Multiplying the rank by a number coprime with the number of pages
+	// permutes the pages without storing the permutation.
+	scatter := uint64(rng.Int63n(int64(numPages))) | 1
+	for gcd(scatter, numPages) != 1 {
+		scatter += 2
+	}
+
+	return &powerLawGenerator{
+		Builder: b,
+		zipf:    rand.NewZipf(rng, alpha, 1, numPages-1),
+		scatter: scatter,
+	}
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
+
+func (b Builder) mustBeValid() {
+	if b.pageSize == 0 {
+		log.Panic("page size must be positive")
+	}
+
+	if b.numPages() == 0 {
+		log.Panicf("footprint %d is smaller than page size %d",
+			b.footprint, b.pageSize)
+	}
+}
+
+func (b Builder) numPages() uint64 {
+	return b.footprint / b.pageSize
+}
+
+func (b Builder) build(offset uint64) *vm.TranslationReq {
+	return vm.TranslationReqBuilder{}.
+		WithPID(b.pid).
+		WithDeviceID(b.deviceID).
+		WithVAddr(b.base + offset).
+		Build()
+}
+
+type stridedGenerator struct {
+	Builder
+
+	stride uint64
+	offset uint64
+}
+
+func (g *stridedGenerator) Next() *vm.TranslationReq {
+	req := g.build(g.offset)
+	g.offset = (g.offset + g.stride) % (g.numPages() * g.pageSize)
+	return req
+}
+
+type randomGenerator struct {
+	Builder
+
+	rng *rand.Rand
+}
+
+func (g *randomGenerator) Next() *vm.TranslationReq {
+	page := uint64(g.rng.Int63n(int64(g.numPages())))
+	return g.build(page * g.pageSize)
+}
+
+type powerLawGenerator struct {
+	Builder
+
+	zipf    *rand.Zipf
+	scatter uint64
+}
+
+func (g *powerLawGenerator) Next() *vm.TranslationReq {
+	hi, lo := bits.Mul64(g.zipf.Uint64(), g.scatter)
+	page := bits.Rem64(hi, lo, g.numPages())
+	return g.build(page * g.pageSize)
+}
+
+// Interleave creates a Generator that takes chunk requests from each of the
+// generators in turn, as processes that share a GPU do.
+func Interleave(chunk int, gens ...Generator) Generator {
+	if chunk <= 0 || len(gens) == 0 {
+		log.Panic("interleaving needs a positive chunk and a generator")
+	}
+
+	return &interleavedGenerator{gens: gens, chunk: chunk}
+}
+
+type interleavedGenerator struct {
+	gens  []Generator
+	chunk int
+	next  int
+	taken int
+}
+
+func (g *interleavedGenerator) Next() *vm.TranslationReq {
+	if g.taken == g.chunk {
+		g.next = (g.next + 1) % len(g.gens)
+		g.taken = 0
+	}
+
+	g.taken++
+	return g.gens[g.next].Next()
+}
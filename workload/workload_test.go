@@ -0,0 +1,138 @@
+package workload
+
+import (
+	"testing"
+
+	"github.com/sarchlab/akita/v3/mem/vm"
+)
+
+func vAddrs(reqs []*vm.TranslationReq) []uint64 {
+	var addrs []uint64
+	for _, req := range reqs {
+		addrs = append(addrs, req.VAddr)
+	}
+
+	return addrs
+}
+
+func TestStreamWrapsAroundFootprint(t *testing.T) {
+	g := MakeBuilder().
+		WithBase(0x10000).
+		WithFootprint(3 * 4096).
+		BuildStream()
+
+	got := vAddrs(Take(g, 4))
+	want := []uint64{0x10000, 0x11000, 0x12000, 0x10000}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("addresses = %x, want %x", got, want)
+		}
+	}
+}
+
+func TestStridedSkipsPages(t *testing.T) {
+	g := MakeBuilder().WithFootprint(1 << 20).BuildStrided(3 * 4096)
+
+	got := vAddrs(Take(g, 3))
+	if got[1] != 3*4096 || got[2] != 6*4096 {
+		t.Errorf("addresses = %x, want a stride of 3 pages", got)
+	}
+}
+
+func TestStridedStaysAlignedInPartialFootprint(t *testing.T) {
+	g := MakeBuilder().
+		WithFootprint(5*4096 + 100).
+		BuildStrided(2 * 4096)
+
+	for _, vAddr := range vAddrs(Take(g, 20)) {
+		if vAddr%4096 != 0 || vAddr >= 5*4096 {
+			t.Fatalf("address %#x is not a page of the footprint", vAddr)
+		}
+	}
+}
+
+func TestStridedRejectsUnalignedStrides(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("a stride of 100 bytes was accepted")
+		}
+	}()
+
+	MakeBuilder().BuildStrided(100)
+}
+
+func TestGeneratorsStayInFootprint(t *testing.T) {
+	b := MakeBuilder().
+		WithPID(7).
+		WithDeviceID(2).
+		WithBase(1 << 40).
+		WithFootprint(1 << 24).
+		WithPageSize(1 << 16)
+
+	gens := map[string]Generator{
+		"random":    b.BuildRandom(),
+		"power-law": b.BuildPowerLaw(1.2),
+	}
+
+	for name, g := range gens {
+		t.Run(name, func(t *testing.T) {
+			for _, req := range Take(g, 1000) {
+				if req.VAddr < 1<<40 || req.VAddr >= 1<<40+1<<24 ||
+					req.VAddr%(1<<16) != 0 {
+					t.Fatalf("address 0x%x is not a page of the footprint",
+						req.VAddr)
+				}
+
+				if req.PID != 7 || req.DeviceID != 2 {
+					t.Fatalf("request of PID %d on device %d, want 7 and 2",
+						req.PID, req.DeviceID)
+				}
+			}
+		})
+	}
+}
+
+func TestPowerLawFavorsFewPages(t *testing.T) {
+	g := MakeBuilder().WithFootprint(1 << 30).BuildPowerLaw(1.5)
+
+	counts := make(map[uint64]int)
+	for _, req := range Take(g, 10000) {
+		counts[req.VAddr]++
+	}
+
+	maxCount := 0
+	for _, c := range counts {
+		maxCount = max(maxCount, c)
+	}
+
+	if maxCount < 1000 {
+		t.Errorf("hottest page has %d of 10000 accesses", maxCount)
+	}
+}
+
+func TestSeedMakesRandomReproducible(t *testing.T) {
+	a := vAddrs(Take(MakeBuilder().WithSeed(3).BuildRandom(), 10))
+	b := vAddrs(Take(MakeBuilder().WithSeed(3).BuildRandom(), 10))
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("same seed gave %x and %x", a, b)
+		}
+	}
+}
+
+func TestInterleaveTakesChunks(t *testing.T) {
+	b := MakeBuilder().WithFootprint(1 << 20)
+	g := Interleave(2, b.WithPID(1).BuildStream(), b.WithPID(2).BuildStream())
+
+	var pids []vm.PID
+	for _, req := range Take(g, 6) {
+		pids = append(pids, req.PID)
+	}
+
+	want := []vm.PID{1, 1, 2, 2, 1, 1}
+	for i := range want {
+		if pids[i] != want[i] {
+			t.Fatalf("PIDs = %v, want %v", pids, want)
+		}
+	}
+}